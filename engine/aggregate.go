@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/transform"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+type AggregateFunction string
+
+const (
+	CountAggregate         AggregateFunction = "count"
+	SumAggregate           AggregateFunction = "sum"
+	MinAggregate           AggregateFunction = "min"
+	MaxAggregate           AggregateFunction = "max"
+	AvgAggregate           AggregateFunction = "avg"
+	DistinctCountAggregate AggregateFunction = "distinct_count"
+)
+
+var aggregateFunctions = []AggregateFunction{
+	CountAggregate, SumAggregate, MinAggregate, MaxAggregate, AvgAggregate, DistinctCountAggregate,
+}
+
+/*
+Aggregate computes Function over the values of Field in a group, naming the result Name.
+A count without Field counts the entities of the group.
+Undefined values are skipped, and any function other than a count is Undefined for a group without values.
+*/
+type Aggregate struct {
+	Name     string
+	Function AggregateFunction
+	Field    FieldName
+}
+
+/*
+AggregationSpec groups the entities matching a query by the values of the GroupBy fields, and computes the Aggregates
+of each group. Entities without a value for a GroupBy field are grouped under Undefined.
+Without GroupBy fields, every entity is part of a single group.
+*/
+type AggregationSpec struct {
+	GroupBy    []FieldName
+	Aggregates []Aggregate
+}
+
+func (s AggregationSpec) fields() []FieldName {
+	fields := []FieldName{}
+	for _, f := range s.GroupBy {
+		if !slices.Contains(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+	for _, a := range s.Aggregates {
+		if a.Field != "" && !slices.Contains(fields, a.Field) {
+			fields = append(fields, a.Field)
+		}
+	}
+
+	return fields
+}
+
+/*
+Group is the result of the aggregates over the entities sharing the same values for the GroupBy fields
+*/
+type Group struct {
+	Keys   map[FieldName]value.Value
+	Values map[string]value.Value
+}
+
+/*
+AggregatingDataSource can be implemented by a producer able to compute aggregations itself.
+When it is the only producer, can filter by the whole query and provides every field of the spec,
+ProcessAggregation asks it for the groups instead of retrieving the entities. Returning false makes the engine compute them.
+*/
+type AggregatingDataSource interface {
+	Aggregate(ctx context.Context, query QueryExpression, spec AggregationSpec) ([]Group, bool, error)
+}
+
+/*
+ProcessAggregation works like ProcessQuery, but returns the groups of the spec computed over the matching entities,
+sorted by their keys
+*/
+func (e *ExpressionResolver[T]) ProcessAggregation(ctx context.Context, query QueryExpression, spec AggregationSpec) (
+	[]Group,
+	bool,
+	error,
+) {
+	for _, a := range spec.Aggregates {
+		if !slices.Contains(aggregateFunctions, a.Function) {
+			return nil, false, fmt.Errorf("unknown aggregate function %s", a.Function)
+		}
+		if a.Field == "" && a.Function != CountAggregate {
+			return nil, false, fmt.Errorf("aggregate %s needs a field to compute %s", a.Name, a.Function)
+		}
+	}
+
+	if groups, ok, err := e.pushdownAggregation(ctx, query, spec); err != nil || ok {
+		return groups, ok, err
+	}
+
+	f := e.newFetcher()
+	entities, affected, err := e.resolveClauses(ctx, f, query)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the fields of the spec are retrieved without filtering out the entities that lack them
+	if len(entities) > 0 {
+		entities, _, err = e.retrieveQueryFields(ctx, f, optionalFieldsQuery(spec.fields()), entities, true)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	groups, err := aggregateEntities(entities, spec)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, solved, err := e.degradedResult(f, nil, affected)
+	return groups, solved, err
+}
+
+// pushdownAggregation asks the only producer for the groups, if it can compute them by itself
+func (e *ExpressionResolver[T]) pushdownAggregation(ctx context.Context, query QueryExpression, spec AggregationSpec) (
+	[]Group,
+	bool,
+	error,
+) {
+	producer, ok := e.singleProducer()
+	if !ok {
+		return nil, false, nil
+	}
+
+	aggregating, ok := e.sources[producer].(AggregatingDataSource)
+	if !ok {
+		return nil, false, nil
+	}
+
+	for _, f := range spec.fields() {
+		if !slices.Contains(e.sources[producer].GetRetrievableFields(), f) {
+			return nil, false, nil
+		}
+	}
+
+	query = transform.ToDisjunctiveNormalForm(query)
+	for _, clause := range query.(*operator.Or).Terms {
+		and := clause.(*operator.And)
+		if len(pushdownQuery(e.sources[producer], and).Terms) != len(and.Terms) {
+			return nil, false, nil
+		}
+	}
+
+	return aggregating.Aggregate(ctx, query, spec)
+}
+
+type accumulator struct {
+	count    int64
+	total    value.Value
+	distinct map[string]struct{}
+}
+
+func aggregateEntities[T comparable](entities Entities[T], spec AggregationSpec) ([]Group, error) {
+	groups := map[string]*Group{}
+	accumulators := map[string][]*accumulator{}
+	addGroup := func(key string, keys map[FieldName]value.Value) {
+		groups[key] = &Group{Keys: keys, Values: map[string]value.Value{}}
+		for range spec.Aggregates {
+			accumulators[key] = append(accumulators[key], &accumulator{distinct: map[string]struct{}{}})
+		}
+	}
+	// without grouping there is always a group, even if nothing matched
+	if len(spec.GroupBy) == 0 {
+		addGroup("", map[FieldName]value.Value{})
+	}
+
+	for _, entity := range entities {
+		keys := map[FieldName]value.Value{}
+		keyNames := []string{}
+		for _, f := range spec.GroupBy {
+			v := definedValue(&entity, f)
+			keys[f] = v
+			keyNames = append(keyNames, fmt.Sprintf("%T:%#v", v, v.MustValue()))
+		}
+
+		key := strings.Join(keyNames, "|")
+		if _, ok := groups[key]; !ok {
+			addGroup(key, keys)
+		}
+
+		for i, a := range spec.Aggregates {
+			if err := accumulators[key][i].add(a, definedValue(&entity, a.Field)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := []Group{}
+	for key, group := range groups {
+		for i, a := range spec.Aggregates {
+			v, err := accumulators[key][i].result(a)
+			if err != nil {
+				return nil, err
+			}
+			group.Values[a.Name] = v
+		}
+		result = append(result, *group)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		for _, f := range spec.GroupBy {
+			c, err := compareSortKeys(result[i].Keys[f], result[j].Keys[f], OrderBy{Field: f})
+			if err == nil && c != 0 {
+				return c < 0
+			}
+		}
+
+		return fmt.Sprintf("%v", result[i].Keys) < fmt.Sprintf("%v", result[j].Keys)
+	})
+
+	return result, nil
+}
+
+// definedValue returns the value of the field, or Undefined if the entity doesn't have one
+func definedValue[T comparable](entity *Entity[T], f FieldName) value.Value {
+	if f == "" || entity.FieldExists(f) != logic.True {
+		return value.Undefined{}
+	}
+
+	v, _ := entity.SeekField(f)
+	return v
+}
+
+func (acc *accumulator) add(a Aggregate, v value.Value) error {
+	if a.Field == "" {
+		acc.count++
+		return nil
+	}
+
+	raw, ok := v.Value()
+	if !ok {
+		return nil
+	}
+	acc.count++
+
+	switch a.Function {
+	case SumAggregate, AvgAggregate:
+		if acc.total == nil {
+			acc.total = v
+			return nil
+		}
+
+		total, err := acc.total.Plus(v)
+		if err != nil {
+			return fmt.Errorf("aggregate %s: %w", a.Name, err)
+		}
+		acc.total = total
+	case MinAggregate, MaxAggregate:
+		if acc.total == nil {
+			acc.total = v
+			return nil
+		}
+
+		less, err := v.Less(acc.total)
+		if a.Function == MaxAggregate {
+			less, err = acc.total.Less(v)
+		}
+		if err != nil {
+			return fmt.Errorf("aggregate %s: %w", a.Name, err)
+		}
+		if less == logic.True {
+			acc.total = v
+		}
+	case DistinctCountAggregate:
+		acc.distinct[fmt.Sprintf("%T:%#v", raw, raw)] = struct{}{}
+	}
+
+	return nil
+}
+
+func (acc *accumulator) result(a Aggregate) (value.Value, error) {
+	switch a.Function {
+	case CountAggregate:
+		return value.NewInt64(acc.count), nil
+	case DistinctCountAggregate:
+		return value.NewInt64(int64(len(acc.distinct))), nil
+	}
+
+	if acc.total == nil {
+		return value.Undefined{}, nil
+	}
+
+	switch a.Function {
+	case AvgAggregate:
+		var total float64
+		switch raw := acc.total.MustValue().(type) {
+		case int64:
+			total = float64(raw)
+		case float64:
+			total = raw
+		default:
+			return nil, fmt.Errorf("aggregate %s can't average %T values", a.Name, raw)
+		}
+
+		return value.NewFloat64(total / float64(acc.count)), nil
+	default:
+		return acc.total, nil
+	}
+}
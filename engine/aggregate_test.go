@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProcessAggregation(t *testing.T) {
+	spec := AggregationSpec{Aggregates: []Aggregate{
+		{Name: "count", Function: CountAggregate},
+		{Name: "with_s", Function: CountAggregate, Field: "s"},
+		{Name: "sum", Function: SumAggregate, Field: "s"},
+		{Name: "max", Function: MaxAggregate, Field: "a"},
+	}}
+	want := map[string]any{"count": int64(4), "with_s": int64(2), "sum": int64(30), "max": int64(3)}
+
+	// planning by cost must not discard the entities lacking a field of the spec
+	costBased := []DataSource[int]{}
+	for _, source := range pageSources() {
+		costBased = append(costBased, statsSource{testSource: source.(*testSource), selectivity: 0.5})
+	}
+
+	for name, sources := range map[string][]DataSource[int]{"concurrent": pageSources(), "by cost": costBased} {
+		t.Run(name, func(t *testing.T) {
+			e := newTestResolver(t, sources)
+			groups, solved, err := e.ProcessAggregation(context.Background(), exists("a"), spec)
+			if err != nil || !solved {
+				t.Fatalf("ProcessAggregation() = %v, %v", solved, err)
+			}
+			if len(groups) != 1 {
+				t.Fatalf("ProcessAggregation() returned %d groups, want 1", len(groups))
+			}
+			for aggregate, v := range want {
+				if got := groups[0].Values[aggregate]; got.MustValue() != v {
+					t.Errorf("%s = %v, want %v", aggregate, got.MustValue(), v)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessAggregationGroupsUndefinedKeys(t *testing.T) {
+	e := newTestResolver(t, pageSources())
+	spec := AggregationSpec{GroupBy: []FieldName{"s"}, Aggregates: []Aggregate{{Name: "count", Function: CountAggregate}}}
+
+	groups, _, err := e.ProcessAggregation(context.Background(), exists("a"), spec)
+	if err != nil {
+		t.Fatalf("ProcessAggregation() error = %v", err)
+	}
+
+	counts := map[any]any{}
+	for _, g := range groups {
+		// an Undefined key has no value
+		counts[g.Keys["s"].MustValue()] = g.Values["count"].MustValue()
+	}
+	want := map[any]any{nil: int64(2), int64(10): int64(1), int64(20): int64(1)}
+	if len(counts) != len(want) {
+		t.Fatalf("groups = %v, want %v", counts, want)
+	}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Errorf("count of group %v = %v, want %v", k, counts[k], v)
+		}
+	}
+}
+
+func TestProcessAggregationRejectsUnknownFunctions(t *testing.T) {
+	e := newTestResolver(t, pageSources())
+	spec := AggregationSpec{Aggregates: []Aggregate{{Name: "median", Function: "median", Field: "a"}}}
+	if _, _, err := e.ProcessAggregation(context.Background(), exists("a"), spec); err == nil {
+		t.Error("ProcessAggregation() accepted an unknown function")
+	}
+}
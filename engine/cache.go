@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+/*
+EntityCache stores the values sources retrieved, keyed by source, entity and field.
+Enrichers are only asked for the entity and field pairs missing in the cache,
+while every value retrieved by any source is stored in it along with the time it was fetched at.
+Values are only served back for the source that retrieved them, so conflict policies still see every source's value.
+Invalidate and InvalidateFields let callers drop values they know are stale, whichever source retrieved them.
+*/
+type EntityCache[T comparable] interface {
+	Get(source string, id T, field FieldName) (CachedValue, bool)
+	Set(source string, id T, field FieldName, v CachedValue)
+	Invalidate(ids ...T)
+	InvalidateFields(id T, fields ...FieldName)
+	Clear()
+}
+
+/*
+WithCache makes the resolver consult the cache before asking enrichers for fields
+*/
+func WithCache[T comparable](cache EntityCache[T]) Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.cache = cache
+	}
+}
+
+/*
+CachedValue is a value a source retrieved, along with the time it was fetched at
+*/
+type CachedValue struct {
+	Value     value.Value
+	FetchedAt time.Time
+}
+
+type requestedFieldsKey struct{}
+
+/*
+RequestedFieldsFromContext returns the fields the engine needs from an enricher for the entities it receives,
+when the rest of its fields are already cached for them. The source may retrieve only those, or every field anyway.
+*/
+func RequestedFieldsFromContext(ctx context.Context) ([]FieldName, bool) {
+	fields, ok := ctx.Value(requestedFieldsKey{}).([]FieldName)
+	return fields, ok
+}
+
+type cacheKey[T comparable] struct {
+	source string
+	id     T
+	field  FieldName
+}
+
+type cacheEntry[T comparable] struct {
+	key       cacheKey[T]
+	value     CachedValue
+	expiresAt time.Time
+}
+
+/*
+LRUCache is an in-memory EntityCache holding up to capacity values, evicting the least recently used first.
+Values expire after the TTL of their field, or the default one. A TTL of 0 means they never expire.
+*/
+type LRUCache[T comparable] struct {
+	capacity   int
+	defaultTTL time.Duration
+	fieldTTLs  map[FieldName]time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey[T]]*list.Element
+	order   *list.List
+	onEvict func(source string, id T, field FieldName)
+}
+
+func NewLRUCache[T comparable](capacity int, defaultTTL time.Duration, fieldTTLs map[FieldName]time.Duration) *LRUCache[T] {
+	if fieldTTLs == nil {
+		fieldTTLs = map[FieldName]time.Duration{}
+	}
+
+	return &LRUCache[T]{
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		fieldTTLs:  fieldTTLs,
+		entries:    map[cacheKey[T]]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+/*
+OnEvict sets a hook called whenever a value leaves the cache, either evicted, expired or invalidated.
+The hook runs while the cache is locked, so it must not call back into it.
+*/
+func (c *LRUCache[T]) OnEvict(hook func(source string, id T, field FieldName)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = hook
+}
+
+func (c *LRUCache[T]) Get(source string, id T, field FieldName) (CachedValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[cacheKey[T]{source: source, id: id, field: field}]
+	if !ok {
+		return CachedValue{}, false
+	}
+
+	entry := element.Value.(*cacheEntry[T])
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return CachedValue{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *LRUCache[T]) Set(source string, id T, field FieldName, v CachedValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl, ok := c.fieldTTLs[field]
+	if !ok {
+		ttl = c.defaultTTL
+	}
+
+	entry := &cacheEntry[T]{
+		key:   cacheKey[T]{source: source, id: id, field: field},
+		value: v,
+	}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRUCache[T]) Invalidate(ids ...T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	invalid := map[T]struct{}{}
+	for _, id := range ids {
+		invalid[id] = struct{}{}
+	}
+
+	for key, element := range c.entries {
+		if _, ok := invalid[key.id]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *LRUCache[T]) InvalidateFields(id T, fields ...FieldName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	invalid := map[FieldName]struct{}{}
+	for _, f := range fields {
+		invalid[f] = struct{}{}
+	}
+
+	for key, element := range c.entries {
+		if _, ok := invalid[key.field]; ok && key.id == id {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *LRUCache[T]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, element := range c.entries {
+		c.remove(element)
+	}
+}
+
+func (c *LRUCache[T]) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry[T])
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+
+	if c.onEvict != nil {
+		c.onEvict(entry.key.source, entry.key.id, entry.key.field)
+	}
+}
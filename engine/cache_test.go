@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUCache[int](2, 0, nil)
+	evicted := []int{}
+	c.OnEvict(func(_ string, id int, _ FieldName) {
+		evicted = append(evicted, id)
+	})
+
+	c.Set("s", 1, "a", CachedValue{Value: value.NewInt64(1)})
+	c.Set("s", 2, "a", CachedValue{Value: value.NewInt64(2)})
+	c.Get("s", 1, "a")
+	c.Set("s", 3, "a", CachedValue{Value: value.NewInt64(3)})
+
+	if _, ok := c.Get("s", 2, "a"); ok {
+		t.Error("Get() found the least recently used value")
+	}
+	if _, ok := c.Get("s", 1, "a"); !ok {
+		t.Error("Get() lost a recently used value")
+	}
+	if len(evicted) != 1 || evicted[0] != 2 {
+		t.Errorf("evicted = %v, want [2]", evicted)
+	}
+}
+
+func TestLRUCacheExpiresValues(t *testing.T) {
+	c := NewLRUCache[int](0, time.Hour, map[FieldName]time.Duration{"short": time.Nanosecond})
+	c.Set("s", 1, "short", CachedValue{Value: value.NewInt64(1)})
+	c.Set("s", 1, "long", CachedValue{Value: value.NewInt64(1)})
+	time.Sleep(time.Millisecond)
+
+	if _, ok := c.Get("s", 1, "short"); ok {
+		t.Error("Get() returned an expired value")
+	}
+	if _, ok := c.Get("s", 1, "long"); !ok {
+		t.Error("Get() lost a value that didn't expire")
+	}
+}
+
+func TestLRUCacheKeepsSourcesApart(t *testing.T) {
+	c := NewLRUCache[int](0, 0, nil)
+	c.Set("a", 1, "x", CachedValue{Value: value.NewInt64(1)})
+	c.Set("b", 1, "x", CachedValue{Value: value.NewInt64(2)})
+
+	if v, _ := c.Get("a", 1, "x"); v.Value.MustValue() != int64(1) {
+		t.Errorf("Get(a) = %v, want 1", v.Value.MustValue())
+	}
+	if _, ok := c.Get("c", 1, "x"); ok {
+		t.Error("Get() served a value to a source that didn't retrieve it")
+	}
+
+	c.InvalidateFields(1, "x")
+	_, okA := c.Get("a", 1, "x")
+	_, okB := c.Get("b", 1, "x")
+	if okA || okB {
+		t.Error("InvalidateFields() kept the value of some source")
+	}
+}
+
+func TestCachedValuesKeepTheirSource(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"id"}, rows: map[int]row{
+		1: {"id": value.NewInt64(1)},
+	}}
+	a := &testSource{name: "a", role: EnricherRole, fields: []FieldName{"x", "y"}, rows: map[int]row{
+		1: {"x": value.NewInt64(1), "y": value.NewInt64(1)},
+	}}
+	// b runs after a, so the value of x cached for a must not be served as b's
+	b := &testSource{name: "b", role: EnricherRole, fields: []FieldName{"x"}, required: []FieldName{"y"}, rows: map[int]row{
+		1: {"x": value.NewInt64(2)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{producer, a, b},
+		WithCache[int](NewLRUCache[int](0, 0, nil)),
+		WithConflictPolicy[int]("x", LastWins()),
+	)
+
+	for i := 0; i < 2; i++ {
+		entities, _, err := e.ProcessQuery(context.Background(), operator.NewAnd(operator.NewExists("id")), ResultSchema{"x"})
+		if err != nil {
+			t.Fatalf("ProcessQuery() error = %v", err)
+		}
+
+		entity := entities[1]
+		v, _ := entity.SeekField("x")
+		metadata, _ := entity.GetFieldMetadata("x")
+		if v.MustValue() != int64(2) || metadata.Source != "b" {
+			t.Errorf("query %d: x = %v from %s, want 2 from b", i+1, v.MustValue(), metadata.Source)
+		}
+	}
+
+	// the second query is served from the cache
+	if na, nb := a.callCount(), b.callCount(); na != 1 || nb != 1 {
+		t.Errorf("sources were called a=%d b=%d times, want once each", na, nb)
+	}
+}
+
+func TestCacheOnlyRequestsMissingFields(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"id"}, rows: map[int]row{
+		1: {"id": value.NewInt64(1)},
+		2: {"id": value.NewInt64(2)},
+		3: {"id": value.NewInt64(3)},
+	}}
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"x", "y"}, rows: map[int]row{
+		1: {"x": value.NewInt64(10), "y": value.NewInt64(10)},
+		2: {"x": value.NewInt64(20), "y": value.NewInt64(20)},
+		3: {"x": value.NewInt64(30), "y": value.NewInt64(30)},
+	}}
+
+	fetchedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewLRUCache[int](0, 0, nil)
+	cache.Set("enricher", 1, "x", CachedValue{Value: value.NewInt64(1), FetchedAt: fetchedAt})
+	cache.Set("enricher", 1, "y", CachedValue{Value: value.NewInt64(1), FetchedAt: fetchedAt})
+	cache.Set("enricher", 2, "x", CachedValue{Value: value.NewInt64(2), FetchedAt: fetchedAt})
+	e := newTestResolver(t, []DataSource[int]{producer, enricher}, WithCache[int](cache))
+
+	entities, _, err := e.ProcessQuery(context.Background(), exists("id"), ResultSchema{"x", "y"})
+	if err != nil {
+		t.Fatalf("ProcessQuery() error = %v", err)
+	}
+
+	// entity 1 is fully cached, entity 2 only misses y, and entity 3 misses every field
+	requested := map[int][]FieldName{}
+	for i, call := range enricher.calls {
+		for id := range call {
+			requested[id] = enricher.requested[i]
+		}
+	}
+	tests := []struct {
+		id        int
+		called    bool
+		requested []FieldName
+		x, y      int64
+		xFetched  bool
+	}{
+		{id: 1, x: 1, y: 1, xFetched: true},
+		{id: 2, called: true, requested: []FieldName{"y"}, x: 20, y: 20},
+		{id: 3, called: true, x: 30, y: 30},
+	}
+	for _, tt := range tests {
+		fields, called := requested[tt.id]
+		if called != tt.called || !slices.Equal(fields, tt.requested) {
+			t.Errorf("entity %d requested %v (called %t), want %v (called %t)", tt.id, fields, called, tt.requested, tt.called)
+		}
+
+		entity := entities[tt.id]
+		x, _ := entity.SeekField("x")
+		y, _ := entity.SeekField("y")
+		if x.MustValue() != tt.x || y.MustValue() != tt.y {
+			t.Errorf("entity %d = x %v y %v, want x %d y %d", tt.id, x.MustValue(), y.MustValue(), tt.x, tt.y)
+		}
+		// cached values keep the time they were fetched at
+		metadata, _ := entity.GetFieldMetadata("x")
+		if metadata.FetchedAt.Equal(fetchedAt) != tt.xFetched || metadata.Source != "enricher" {
+			t.Errorf("entity %d field x metadata = %+v", tt.id, metadata)
+		}
+	}
+}
+
+func TestCacheKeepsValuesTheSourceDoesNotRetrieveAgain(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"id"}, rows: map[int]row{
+		1: {"id": value.NewInt64(1)},
+	}}
+	// the enricher honors the requested fields, so it only retrieves y
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"x", "y"}, rows: map[int]row{
+		1: {"y": value.NewInt64(10)},
+	}}
+
+	fetchedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewLRUCache[int](0, 0, nil)
+	cache.Set("enricher", 1, "x", CachedValue{Value: value.NewInt64(1), FetchedAt: fetchedAt})
+	e := newTestResolver(t, []DataSource[int]{producer, enricher}, WithCache[int](cache))
+
+	entities, solved, err := e.ProcessQuery(context.Background(), exists("id"), ResultSchema{"x", "y"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+	}
+
+	entity := entities[1]
+	if x, err := entity.SeekField("x"); err != nil || x.MustValue() != int64(1) {
+		t.Errorf("field x = %v, %v, want the cached 1", x, err)
+	}
+	if metadata, _ := entity.GetFieldMetadata("x"); !metadata.FetchedAt.Equal(fetchedAt) {
+		t.Errorf("field x fetched at %v, want %v", metadata.FetchedAt, fetchedAt)
+	}
+}
+
+func TestSourcesMustHaveUniqueNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []DataSource[int]
+		wantErr bool
+	}{
+		{
+			name: "named apart",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}},
+				&testSource{name: "b", fields: []FieldName{"b"}},
+			},
+		},
+		{
+			name: "same name",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}},
+				&testSource{name: "a", fields: []FieldName{"b"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "same type without names",
+			sources: []DataSource[int]{decoratingSource{field: "a"}, decoratingSource{field: "b"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpressionResolver(tt.sources)
+
+			var nameErr DataSourceNameError
+			if errors.As(err, &nameErr) != tt.wantErr {
+				t.Errorf("NewExpressionResolver() error = %v, want a DataSourceNameError %t", err, tt.wantErr)
+			}
+		})
+	}
+}
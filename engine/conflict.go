@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+/*
+SourcedValue is a field value along with the name of the source that supplied it
+*/
+type SourcedValue struct {
+	Value  value.Value
+	Source string
+}
+
+/*
+ConflictPolicy decides which value a field keeps when a source supplies it
+for an entity that already got a value from another source.
+Any function with this signature can be used as a custom merge.
+*/
+type ConflictPolicy func(field FieldName, current, incoming SourcedValue) (SourcedValue, error)
+
+/*
+FieldConflictError is returned by ErrorOnConflict when two sources supply different values for the same field
+*/
+type FieldConflictError struct {
+	Field    FieldName
+	Current  SourcedValue
+	Incoming SourcedValue
+}
+
+func (e FieldConflictError) Error() string {
+	return fmt.Sprintf(
+		"field %s has conflicting values %+v from %s and %+v from %s",
+		e.Field,
+		e.Current.Value.MustValue(),
+		e.Current.Source,
+		e.Incoming.Value.MustValue(),
+		e.Incoming.Source,
+	)
+}
+
+/*
+FirstWins keeps the value of the first source that supplied the field, which is the default
+*/
+func FirstWins() ConflictPolicy {
+	return func(_ FieldName, current, _ SourcedValue) (SourcedValue, error) {
+		return current, nil
+	}
+}
+
+/*
+LastWins keeps the value of the last source that supplied the field
+*/
+func LastWins() ConflictPolicy {
+	return func(_ FieldName, _, incoming SourcedValue) (SourcedValue, error) {
+		return incoming, nil
+	}
+}
+
+/*
+ErrorOnConflict fails the query when sources supply different values for the field
+*/
+func ErrorOnConflict() ConflictPolicy {
+	return func(field FieldName, current, incoming SourcedValue) (SourcedValue, error) {
+		tv, err := current.Value.Equal(incoming.Value)
+		if err != nil || tv != logic.True {
+			return SourcedValue{}, FieldConflictError{
+				Field:    field,
+				Current:  current,
+				Incoming: incoming,
+			}
+		}
+
+		return current, nil
+	}
+}
+
+/*
+SourcePriority keeps the value of the source that comes first in the given names.
+Sources not listed have the lowest priority, and among them the first one wins.
+*/
+func SourcePriority(sources ...string) ConflictPolicy {
+	priority := func(source string) int {
+		if i := slices.Index(sources, source); i >= 0 {
+			return i
+		}
+		return len(sources)
+	}
+
+	return func(_ FieldName, current, incoming SourcedValue) (SourcedValue, error) {
+		if priority(incoming.Source) < priority(current.Source) {
+			return incoming, nil
+		}
+
+		return current, nil
+	}
+}
+
+/*
+WithConflictPolicy sets how conflicting values for the field are resolved
+*/
+func WithConflictPolicy[T comparable](field FieldName, policy ConflictPolicy) Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.conflictPolicies[field] = policy
+	}
+}
+
+func (e *ExpressionResolver[T]) conflictPolicy(field FieldName) ConflictPolicy {
+	if policy, ok := e.conflictPolicies[field]; ok {
+		return policy
+	}
+
+	return FirstWins()
+}
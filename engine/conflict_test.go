@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+func TestConflictPolicies(t *testing.T) {
+	first := SourcedValue{Value: value.NewInt64(1), Source: "first"}
+	second := SourcedValue{Value: value.NewInt64(2), Source: "second"}
+	same := SourcedValue{Value: value.NewInt64(1), Source: "second"}
+
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		incoming SourcedValue
+		want     SourcedValue
+		wantErr  bool
+	}{
+		{name: "first wins", policy: FirstWins(), incoming: second, want: first},
+		{name: "last wins", policy: LastWins(), incoming: second, want: second},
+		{name: "error on conflict", policy: ErrorOnConflict(), incoming: second, wantErr: true},
+		{name: "error on conflict with equal values", policy: ErrorOnConflict(), incoming: same, want: first},
+		{name: "priority to incoming", policy: SourcePriority("second", "first"), incoming: second, want: second},
+		{name: "priority to current", policy: SourcePriority("first", "second"), incoming: second, want: first},
+		{name: "unlisted incoming", policy: SourcePriority("first"), incoming: second, want: first},
+		{name: "unlisted current", policy: SourcePriority("second"), incoming: second, want: second},
+		{name: "none listed", policy: SourcePriority(), incoming: second, want: first},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy("a", first, tt.incoming)
+			if tt.wantErr {
+				var conflict FieldConflictError
+				if !errors.As(err, &conflict) || conflict.Field != "a" || conflict.Current != first || conflict.Incoming != tt.incoming {
+					t.Errorf("policy() error = %v, want a FieldConflictError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("policy() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("policy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictPolicyOfField(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option[int]
+		want    int64
+		source  string
+		wantErr bool
+	}{
+		{name: "default", want: 1, source: "first"},
+		{name: "source priority", opts: []Option[int]{WithConflictPolicy[int]("a", SourcePriority("second"))}, want: 2, source: "second"},
+		{name: "other field", opts: []Option[int]{WithConflictPolicy[int]("b", LastWins())}, want: 1, source: "first"},
+		{name: "error on conflict", opts: []Option[int]{WithConflictPolicy[int]("a", ErrorOnConflict())}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &testSource{name: "first", fields: []FieldName{"a"}, rows: map[int]row{1: {"a": value.NewInt64(1)}}}
+			second := &testSource{name: "second", fields: []FieldName{"a"}, rows: map[int]row{1: {"a": value.NewInt64(2)}}}
+			e := newTestResolver(t, []DataSource[int]{first, second}, tt.opts...)
+
+			entities, _, err := e.ProcessQuery(context.Background(), exists("a"), ResultSchema{"a"})
+			if tt.wantErr {
+				var conflict FieldConflictError
+				if !errors.As(err, &conflict) {
+					t.Errorf("ProcessQuery() error = %v, want a FieldConflictError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessQuery() error = %v", err)
+			}
+
+			entity := entities[1]
+			if v, err := entity.SeekField("a"); err != nil || v.MustValue() != tt.want {
+				t.Errorf("field a = %v, %v, want %d", v, err, tt.want)
+			}
+			// the provenance follows the value that was kept
+			if metadata, ok := entity.GetFieldMetadata("a"); !ok || metadata.Source != tt.source {
+				t.Errorf("field a metadata = %+v, want source %s", metadata, tt.source)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+)
+
+/*
+DataSourceStats can be implemented by a DataSource to let the engine plan by cost.
+Selectivity is the expected fraction of entities, between 0 and 1, that satisfy the predicates over the field.
+When any source implements it, sources are consulted one at a time, cheapest and most selective first,
+and the engine stops fetching as soon as the clause is decided for every entity.
+*/
+type DataSourceStats interface {
+	EstimatedLatency() time.Duration
+	CostPerCall() float64
+	Selectivity(field FieldName) float64
+}
+
+// sourceCost is the cost of a call to the source, counting each millisecond of latency as a unit of cost
+func sourceCost(stats DataSourceStats) float64 {
+	return stats.CostPerCall() + float64(stats.EstimatedLatency())/float64(time.Millisecond)
+}
+
+// sourceSelectivity is the expected fraction of entities that survive the predicates of the query
+// over the fields the source provides
+func sourceSelectivity(stats DataSourceStats, provided []FieldName, query *operator.And) float64 {
+	queryFields := map[FieldName]struct{}{}
+	for _, f := range query.GetFieldNames() {
+		queryFields[f] = struct{}{}
+	}
+
+	selectivity := 1.0
+	for _, f := range provided {
+		if _, ok := queryFields[f]; ok {
+			selectivity *= math.Max(0, math.Min(1, stats.Selectivity(f)))
+		}
+	}
+
+	return selectivity
+}
+
+// sourceRank orders sources so the ones discarding more entities per unit of cost go first.
+// Sources without stats, or that can't discard anything, go last.
+func sourceRank[T comparable](source DataSource[T], query *operator.And) float64 {
+	stats, ok := source.(DataSourceStats)
+	if !ok {
+		return math.Inf(1)
+	}
+
+	selectivity := sourceSelectivity(stats, source.GetRetrievableFields(), query)
+	if selectivity >= 1 {
+		return math.Inf(1)
+	}
+
+	return sourceCost(stats) / (1 - selectivity)
+}
+
+// rankSources sorts the sources by rank, keeping their order when ranks are equal
+func (e *ExpressionResolver[T]) rankSources(query *operator.And, sources []int) []int {
+	ranked := make([]int, len(sources))
+	copy(ranked, sources)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return sourceRank(e.sources[ranked[i]], query) < sourceRank(e.sources[ranked[j]], query)
+	})
+
+	return ranked
+}
+
+// pruneDecidedEntities removes the entities for which the query is already decided not to hold,
+// and tells if the query is decided for all of the remaining ones
+func pruneDecidedEntities[T comparable](query *operator.And, entities Entities[T], rejected map[T]struct{}) (bool, error) {
+	decided := true
+	for id, entity := range entities {
+		if !query.IsResolvable(&entity) {
+			decided = false
+			continue
+		}
+
+		tv, err := query.Resolve(&entity)
+		if err != nil {
+			return false, err
+		}
+
+		if tv != logic.True {
+			delete(entities, id)
+			rejected[id] = struct{}{}
+		}
+	}
+
+	return decided, nil
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestRankSources(t *testing.T) {
+	selective := statsSource{testSource: &testSource{name: "selective", fields: []FieldName{"b"}}, selectivity: 0.1}
+	unselective := statsSource{testSource: &testSource{name: "unselective", fields: []FieldName{"c"}}, selectivity: 0.9}
+	withoutStats := &testSource{name: "without stats", fields: []FieldName{"d"}}
+	unrelated := statsSource{testSource: &testSource{name: "unrelated", fields: []FieldName{"e"}}, selectivity: 0.1}
+	e := newTestResolver(t, []DataSource[int]{withoutStats, unrelated, unselective, selective})
+
+	query := operator.NewAnd(operator.NewExists("b"), operator.NewExists("c"), operator.NewExists("d"))
+	ranked := []string{}
+	for _, i := range e.rankSources(query, []int{0, 1, 2, 3}) {
+		ranked = append(ranked, sourceName(e.sources[i]))
+	}
+
+	// sources that can't discard entities keep their order at the end
+	want := []string{"selective", "unselective", "without stats", "unrelated"}
+	if !slices.Equal(ranked, want) {
+		t.Errorf("rankSources() = %v, want %v", ranked, want)
+	}
+}
+
+func TestCostBasedPlanningNarrowsDownEntities(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+		3: {"a": value.NewInt64(3)},
+	}}
+	selective := &testSource{name: "selective", role: EnricherRole, fields: []FieldName{"b"}, rows: map[int]row{
+		1: {"b": value.NewInt64(1)},
+		2: {"b": value.NewInt64(0)},
+		3: {"b": value.NewInt64(0)},
+	}}
+	var received []int
+	unselective := &testSource{name: "unselective", role: EnricherRole, fields: []FieldName{"c"},
+		seen: func(entities Entities[int]) {
+			received = sortedIDs(entities)
+		},
+		rows: map[int]row{
+			1: {"c": value.NewInt64(1)},
+			2: {"c": value.NewInt64(1)},
+			3: {"c": value.NewInt64(1)},
+		},
+	}
+	e := newTestResolver(t, []DataSource[int]{
+		statsSource{testSource: producer, selectivity: 1},
+		statsSource{testSource: unselective, selectivity: 0.9},
+		statsSource{testSource: selective, selectivity: 0.1},
+	})
+
+	query := operator.NewAnd(equal("b", value.NewInt64(1)), equal("c", value.NewInt64(1)))
+	entities, solved, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+	}
+	// the selective source runs first, so the other one only gets the entities that may still match
+	if !slices.Equal(received, []int{1}) {
+		t.Errorf("unselective source received %v, want [1]", received)
+	}
+}
+
+func TestCostBasedPlanningStopsOnceDecided(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	unneeded := &testSource{name: "unneeded", role: EnricherRole, fields: []FieldName{"c"}, rows: map[int]row{
+		1: {"c": value.NewInt64(1)},
+		2: {"c": value.NewInt64(1)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{
+		statsSource{testSource: producer, selectivity: 0.1},
+		statsSource{testSource: unneeded, selectivity: 0.9},
+	})
+
+	// no entity has a = 3, so c is never needed
+	query := operator.NewAnd(equal("a", value.NewInt64(3)), equal("c", value.NewInt64(1)))
+	entities, _, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if err != nil {
+		t.Fatalf("ProcessQuery() error = %v", err)
+	}
+	if len(entities) != 0 {
+		t.Errorf("ProcessQuery() ids = %v, want none", sortedIDs(entities))
+	}
+	if n := unneeded.callCount(); n != 0 {
+		t.Errorf("a source that couldn't change the result was called %d times", n)
+	}
+}
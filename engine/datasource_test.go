@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+type row = map[FieldName]value.Value
+
+// testSource is a DataSource over fixed rows that records how it is called.
+// Producers return every row, and enrichers the rows of the entities they receive.
+type testSource struct {
+	name     string
+	role     Role
+	fields   []FieldName
+	required []FieldName
+	rows     map[int]row
+	// mark makes the source add a field named after it to the entities it receives, like careless sources do
+	mark bool
+	// seen records the fields of the entities each call received
+	seen func(entities Entities[int])
+	// err fails every call, or only the first failures ones if set
+	err      error
+	failures int
+	// delay makes each call take that long, unless its context is done before
+	delay time.Duration
+	// declines makes the source never apply
+	declines bool
+
+	mu      sync.Mutex
+	calls   []Entities[int]
+	queries []QueryExpression
+	// requested records the fields each call was asked for, or nil if it was asked for all of them
+	requested [][]FieldName
+}
+
+func (s *testSource) GetName() string {
+	return s.name
+}
+
+func (s *testSource) GetRole() Role {
+	if s.role == "" {
+		return ProducerRole
+	}
+	return s.role
+}
+
+func (s *testSource) GetRetrievableFields() []FieldName {
+	return s.fields
+}
+
+func (s *testSource) GetRequiredFields() []FieldName {
+	return s.required
+}
+
+func (s *testSource) RetrieveFields(ctx context.Context, query QueryExpression, entities Entities[int]) (Entities[int], bool, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, entities)
+	s.queries = append(s.queries, query)
+	requested, _ := RequestedFieldsFromContext(ctx)
+	s.requested = append(s.requested, requested)
+	call := len(s.calls)
+	s.mu.Unlock()
+
+	if s.seen != nil {
+		s.seen(entities)
+	}
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	if s.err != nil && (s.failures == 0 || call <= s.failures) {
+		return nil, false, s.err
+	}
+	if s.declines {
+		return nil, false, nil
+	}
+
+	if s.mark {
+		for _, entity := range entities {
+			entity.AddField(s.name+".mark", value.NewBool(true))
+		}
+	}
+
+	result := Entities[int]{}
+	for id, r := range s.rows {
+		if _, ok := entities[id]; !ok && s.GetRole() == EnricherRole {
+			continue
+		}
+
+		entity := NewEntity(id)
+		for fn, v := range r {
+			entity.AddField(fn, v)
+		}
+		result[id] = entity
+	}
+
+	return result, true, nil
+}
+
+func (s *testSource) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.calls)
+}
+
+// statsSource is a testSource that lets the engine plan by cost
+type statsSource struct {
+	*testSource
+	selectivity float64
+}
+
+func (s statsSource) EstimatedLatency() time.Duration {
+	return time.Millisecond
+}
+
+func (s statsSource) CostPerCall() float64 {
+	return 1
+}
+
+func (s statsSource) Selectivity(field FieldName) float64 {
+	return s.selectivity
+}
+
+// capableSource is a testSource that only receives the terms it declares support for
+type capableSource struct {
+	*testSource
+	operators map[FieldName][]operator.ComparisonType
+}
+
+func (s capableSource) GetSupportedOperators() map[FieldName][]operator.ComparisonType {
+	return s.operators
+}
+
+func newTestResolver(t *testing.T, sources []DataSource[int], opts ...Option[int]) *ExpressionResolver[int] {
+	t.Helper()
+
+	e, err := NewExpressionResolver(sources, opts...)
+	if err != nil {
+		t.Fatalf("building resolver: %v", err)
+	}
+
+	return e
+}
+
+func sortedIDs(entities Entities[int]) []int {
+	ids := []int{}
+	for id := range entities {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+func pageIDs(page Page[int]) []int {
+	ids := []int{}
+	for _, entity := range page.Entities {
+		ids = append(ids, entity.GetID())
+	}
+
+	return ids
+}
+
+func exists(f FieldName) *operator.And {
+	return operator.NewAnd(operator.NewExists(f))
+}
+
+func equal(f FieldName, v value.Value) *operator.Equal {
+	return operator.NewEqual(operator.NewField(f), operator.NewConst(v))
+}
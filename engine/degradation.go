@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrQueryDegraded = errors.New("query was solved without some sources")
+	ErrCircuitOpen   = errors.New("source circuit is open")
+)
+
+/*
+DegradedSource is a source that was left out of a query, along with the error that made it unavailable
+*/
+type DegradedSource struct {
+	Name string
+	Err  error
+}
+
+/*
+QueryDegradedError lists the sources that were left out of a query when degrading gracefully,
+and the entities whose result depended on the fields they would have provided.
+It matches ErrQueryDegraded when using errors.Is.
+*/
+type QueryDegradedError[T comparable] struct {
+	Sources  []DegradedSource
+	Entities []T
+}
+
+func (e QueryDegradedError[T]) Error() string {
+	sources := []string{}
+	for _, s := range e.Sources {
+		sources = append(sources, fmt.Sprintf("%s: %s", s.Name, s.Err))
+	}
+
+	entities := []string{}
+	for _, id := range e.Entities {
+		entities = append(entities, fmt.Sprintf("%v", id))
+	}
+
+	return fmt.Errorf(
+		"%w: degraded sources [%s], affected entities [%s]",
+		ErrQueryDegraded,
+		strings.Join(sources, ", "),
+		strings.Join(entities, ", "),
+	).Error()
+}
+
+func (e QueryDegradedError[T]) Is(target error) bool {
+	return target == ErrQueryDegraded
+}
+
+/*
+WithGracefulDegradation makes sources that fail, or whose circuit is open, unavailable instead of failing the query.
+Their fields are left unknown, so the three-valued logic decides if the query can still be answered without them.
+ProcessQuery then returns what it could solve, reporting false and a QueryDegradedError
+when the result of some entity depended on the missing fields.
+When no entity did, the result is complete and no error is returned, even if some source was left out.
+*/
+func WithGracefulDegradation[T comparable]() Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.degrade = true
+	}
+}
+
+func (f *fetcher[T]) markDegraded(source string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.degraded[source]; !ok {
+		f.degraded[source] = err
+	}
+}
+
+func (f *fetcher[T]) degradedSources() []DegradedSource {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sources := []DegradedSource{}
+	for name, err := range f.degraded {
+		sources = append(sources, DegradedSource{Name: name, Err: err})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+
+	return sources
+}
+
+// dependsOnDegradedSources tells if the entity is left undecided by the query
+// because of fields only the degraded sources could have provided
+func (e *ExpressionResolver[T]) dependsOnDegradedSources(f *fetcher[T], query *operator.And, entity *Entity[T], declined []DataSource[T]) (
+	bool,
+	error,
+) {
+	tv, remaining, err := reduceQuery(query, entity)
+	if err != nil || tv == logic.False {
+		return false, err
+	}
+
+	degraded := f.degradedSources()
+	for _, source := range declined {
+		if !slices.ContainsFunc(degraded, func(s DegradedSource) bool { return s.Name == sourceName(source) }) {
+			continue
+		}
+
+		for _, term := range remaining {
+			for _, fn := range term.GetFieldNames() {
+				if entity.FieldExists(fn) == logic.Undefined && slices.Contains(source.GetRetrievableFields(), fn) {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// degradedResult reports the sources that were left out of the query along with the entities they affected,
+// as long as they affected some
+func (e *ExpressionResolver[T]) degradedResult(f *fetcher[T], entities Entities[T], affected map[T]struct{}) (Entities[T], bool, error) {
+	sources := f.degradedSources()
+	if !e.degrade || len(sources) == 0 || len(affected) == 0 {
+		return entities, true, nil
+	}
+
+	ids := []T{}
+	for id := range affected {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return fmt.Sprintf("%v", ids[i]) < fmt.Sprintf("%v", ids[j])
+	})
+
+	return entities, false, QueryDegradedError[T]{
+		Sources:  sources,
+		Entities: ids,
+	}
+}
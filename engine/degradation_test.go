@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+func TestDegradationWithoutAffectedEntitiesIsNotAnError(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	// the failing source provides a field neither the query nor the schema need
+	failing := &testSource{name: "failing", role: EnricherRole, fields: []FieldName{"z"}, err: errUnavailable}
+	e := newTestResolver(t, []DataSource[int]{producer, failing}, WithGracefulDegradation[int]())
+
+	entities, solved, err := e.ProcessQuery(context.Background(), exists("a"), ResultSchema{"a"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v, want solved without error", solved, err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1 2]", ids)
+	}
+}
+
+func TestDegradationReportsAffectedEntities(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	failing := &testSource{name: "failing", role: EnricherRole, fields: []FieldName{"b"}, err: errUnavailable}
+	e := newTestResolver(t, []DataSource[int]{producer, failing}, WithGracefulDegradation[int]())
+
+	// entity 1 is decided without b, while entity 2 needs it
+	query := operator.NewAnd(operator.NewOr(
+		equal("a", value.NewInt64(1)),
+		equal("b", value.NewInt64(2)),
+	))
+	entities, solved, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if solved {
+		t.Error("ProcessQuery() solved = true, want false")
+	}
+
+	var degraded QueryDegradedError[int]
+	if !errors.As(err, &degraded) || !errors.Is(err, ErrQueryDegraded) {
+		t.Fatalf("ProcessQuery() error = %v, want a QueryDegradedError", err)
+	}
+	if len(degraded.Sources) != 1 || degraded.Sources[0].Name != "failing" || !errors.Is(degraded.Sources[0].Err, errUnavailable) {
+		t.Errorf("degraded sources = %+v, want failing", degraded.Sources)
+	}
+	if !slices.Equal(degraded.Entities, []int{2}) {
+		t.Errorf("affected entities = %v, want [2]", degraded.Entities)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+	}
+}
+
+func TestFailingSourceFailsTheQueryWithoutDegradation(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+	}}
+	failing := &testSource{name: "failing", role: EnricherRole, fields: []FieldName{"b"}, err: errUnavailable}
+	e := newTestResolver(t, []DataSource[int]{producer, failing})
+
+	if _, _, err := e.ProcessQuery(context.Background(), exists("a"), ResultSchema{"a", "b"}); !errors.Is(err, errUnavailable) {
+		t.Errorf("ProcessQuery() error = %v, want %v", err, errUnavailable)
+	}
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+DataSourceDependencies can be implemented by a DataSource that needs some fields
+to be retrieved before it can retrieve its own ones.
+The engine won't call it until every source providing those fields was consulted.
+Sources implementing neither it nor DataSourceRole are consulted one at a time instead,
+each one after every source registered before it.
+*/
+type DataSourceDependencies interface {
+	GetRequiredFields() []FieldName
+}
+
+/*
+DataSourceCycleError is returned when sources depend on each other's fields in a cycle
+*/
+type DataSourceCycleError struct {
+	Sources []string
+}
+
+func (e DataSourceCycleError) Error() string {
+	return fmt.Sprintf("data sources have a dependency cycle: %s", strings.Join(e.Sources, " -> "))
+}
+
+/*
+dependencyGraph is a DAG over the sources, where each source points to the ones providing its required fields.
+order is a topological order of the sources that keeps the registration order whenever possible,
+and levels tells for each source the length of the longest chain of dependencies before it.
+*/
+type dependencyGraph struct {
+	dependencies [][]int
+	order        []int
+	levels       []int
+}
+
+func newDependencyGraph[T comparable](sources []DataSource[T]) (dependencyGraph, error) {
+	providers := map[FieldName][]int{}
+	for i, source := range sources {
+		for _, f := range source.GetRetrievableFields() {
+			providers[f] = append(providers[f], i)
+		}
+	}
+
+	graph := dependencyGraph{
+		dependencies: make([][]int, len(sources)),
+		levels:       make([]int, len(sources)),
+	}
+	producers := []int{}
+	for i, source := range sources {
+		if sourceRole(source) == ProducerRole {
+			producers = append(producers, i)
+		}
+	}
+
+	for i, source := range sources {
+		required := []int{}
+		// enrichers can only decorate entities once every producer is done
+		if sourceRole(source) == EnricherRole {
+			required = append(required, producers...)
+		}
+		if dependent, ok := source.(DataSourceDependencies); ok {
+			for _, f := range dependent.GetRequiredFields() {
+				required = append(required, providers[f]...)
+			}
+		}
+
+		seen := map[int]struct{}{}
+		for _, p := range required {
+			// a source providing a field it requires can't help itself, so it is ignored
+			if _, ok := seen[p]; ok || p == i {
+				continue
+			}
+			seen[p] = struct{}{}
+			graph.dependencies[i] = append(graph.dependencies[i], p)
+		}
+	}
+
+	if cycle := graph.findCycle(); cycle != nil {
+		names := []string{}
+		for _, s := range cycle {
+			names = append(names, sourceName(sources[s]))
+		}
+		return dependencyGraph{}, DataSourceCycleError{Sources: names}
+	}
+
+	placed := map[int]struct{}{}
+	for len(graph.order) < len(sources) {
+		for i := range sources {
+			if _, ok := placed[i]; ok || !graph.isReady(i, placed) {
+				continue
+			}
+			placed[i] = struct{}{}
+			graph.order = append(graph.order, i)
+			for _, d := range graph.dependencies[i] {
+				graph.levels[i] = max(graph.levels[i], graph.levels[d]+1)
+			}
+			break
+		}
+	}
+
+	return graph, nil
+}
+
+// declaresDependencies tells if the source declares what it depends on, either through its role or its required fields
+func declaresDependencies[T comparable](source DataSource[T]) bool {
+	_, roled := source.(DataSourceRole)
+	_, dependent := source.(DataSourceDependencies)
+	return roled || dependent
+}
+
+// isReady tells if every dependency of the source was already settled
+func (g dependencyGraph) isReady(source int, settled map[int]struct{}) bool {
+	for _, d := range g.dependencies[source] {
+		if _, ok := settled[d]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findCycle returns the sources forming a cycle, starting and ending with the same one, or nil if there is none
+func (g dependencyGraph) findCycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(g.dependencies))
+	path := []int{}
+	var visit func(s int) []int
+	visit = func(s int) []int {
+		state[s] = visiting
+		path = append(path, s)
+		for _, d := range g.dependencies[s] {
+			switch state[d] {
+			case visiting:
+				for i, p := range path {
+					if p == d {
+						return append(append([]int{}, path[i:]...), d)
+					}
+				}
+			case unvisited:
+				if cycle := visit(d); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[s] = visited
+
+		return nil
+	}
+
+	for s := range g.dependencies {
+		if state[s] != unvisited {
+			continue
+		}
+		if cycle := visit(s); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []DataSource[int]
+		order   []int
+		levels  []int
+	}{
+		{
+			name: "registration order",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}},
+				&testSource{name: "b", fields: []FieldName{"b"}},
+			},
+			order:  []int{0, 1},
+			levels: []int{0, 0},
+		},
+		{
+			name: "required fields first",
+			sources: []DataSource[int]{
+				&testSource{name: "c", fields: []FieldName{"c"}, required: []FieldName{"b"}},
+				&testSource{name: "b", fields: []FieldName{"b"}, required: []FieldName{"a"}},
+				&testSource{name: "a", fields: []FieldName{"a"}},
+			},
+			order:  []int{2, 1, 0},
+			levels: []int{2, 1, 0},
+		},
+		{
+			name: "own fields are ignored",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}, required: []FieldName{"a"}},
+				&testSource{name: "b", fields: []FieldName{"b"}},
+			},
+			order:  []int{0, 1},
+			levels: []int{0, 0},
+		},
+		{
+			name: "enrichers after producers",
+			sources: []DataSource[int]{
+				&testSource{name: "e", role: EnricherRole, fields: []FieldName{"e"}},
+				&testSource{name: "a", fields: []FieldName{"a"}},
+				&testSource{name: "b", fields: []FieldName{"b"}},
+			},
+			order:  []int{1, 2, 0},
+			levels: []int{1, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := newDependencyGraph(tt.sources)
+			if err != nil {
+				t.Fatalf("newDependencyGraph() error = %v", err)
+			}
+			if !slices.Equal(graph.order, tt.order) {
+				t.Errorf("order = %v, want %v", graph.order, tt.order)
+			}
+			if !slices.Equal(graph.levels, tt.levels) {
+				t.Errorf("levels = %v, want %v", graph.levels, tt.levels)
+			}
+		})
+	}
+}
+
+func TestDependencyCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []DataSource[int]
+		cycle   []string
+	}{
+		{
+			name: "two sources",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}, required: []FieldName{"b"}},
+				&testSource{name: "b", fields: []FieldName{"b"}, required: []FieldName{"a"}},
+			},
+			cycle: []string{"a", "b", "a"},
+		},
+		{
+			name: "behind another source",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}, required: []FieldName{"b"}},
+				&testSource{name: "b", fields: []FieldName{"b"}, required: []FieldName{"c"}},
+				&testSource{name: "c", fields: []FieldName{"c"}, required: []FieldName{"b"}},
+			},
+			cycle: []string{"b", "c", "b"},
+		},
+		{
+			name: "producer requiring an enricher",
+			sources: []DataSource[int]{
+				&testSource{name: "a", fields: []FieldName{"a"}, required: []FieldName{"e"}},
+				&testSource{name: "e", role: EnricherRole, fields: []FieldName{"e"}},
+			},
+			cycle: []string{"a", "e", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewExpressionResolver(tt.sources)
+
+			var cycleErr DataSourceCycleError
+			if !errors.As(err, &cycleErr) {
+				t.Fatalf("NewExpressionResolver() error = %v, want a DataSourceCycleError", err)
+			}
+			if !slices.Equal(cycleErr.Sources, tt.cycle) {
+				t.Errorf("cycle = %v, want %v", cycleErr.Sources, tt.cycle)
+			}
+		})
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/ZarthaxX/query-resolver/logic"
 	"github.com/ZarthaxX/query-resolver/operator"
 	"github.com/ZarthaxX/query-resolver/transform"
 	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
 )
 
 var ErrQueryExpressionUnsolvable = errors.New("query expression is unsolvable")
@@ -21,17 +24,133 @@ func (e QueryExpressionPartiallySolvableError) Error() string {
 	return fmt.Errorf("query expression was partially solved: %+v", e.RemainingQuery).Error()
 }
 
+/*
+QueryExpressionUnsolvableError explains why a clause could not be solved for some entity.
+It matches ErrQueryExpressionUnsolvable when using errors.Is.
+*/
+type QueryExpressionUnsolvableError struct {
+	Clause               QueryExpression
+	UnresolvedPredicates []QueryExpression
+	MissingFields        []FieldName
+	DeclinedSources      []string
+}
+
+func (e QueryExpressionUnsolvableError) Error() string {
+	predicates := []string{}
+	for _, p := range e.UnresolvedPredicates {
+		predicates = append(predicates, p.String())
+	}
+
+	return fmt.Errorf(
+		"%w: clause %s has unresolved predicates [%s] missing fields [%s], declined sources [%s]",
+		ErrQueryExpressionUnsolvable,
+		e.Clause,
+		strings.Join(predicates, ", "),
+		strings.Join(e.MissingFields, ", "),
+		strings.Join(e.DeclinedSources, ", "),
+	).Error()
+}
+
+func (e QueryExpressionUnsolvableError) Is(target error) bool {
+	return target == ErrQueryExpressionUnsolvable
+}
+
 type DataSource[T comparable] interface {
 	RetrieveFields(ctx context.Context, query QueryExpression, entities Entities[T]) (Entities[T], bool, error)
 	GetRetrievableFields() []FieldName
 }
 
+/*
+NamedDataSource can be implemented by a DataSource to be identified in errors, plans, caches and policies.
+Sources that don't implement it are named after their type, and no two sources can share a name.
+*/
+type NamedDataSource interface {
+	GetName() string
+}
+
+/*
+DataSourceNameError is returned when more than one source has the same name
+*/
+type DataSourceNameError struct {
+	Name string
+}
+
+func (e DataSourceNameError) Error() string {
+	return fmt.Sprintf("more than one data source is named %s", e.Name)
+}
+
+func sourceName[T comparable](source DataSource[T]) string {
+	if named, ok := source.(NamedDataSource); ok {
+		return named.GetName()
+	}
+
+	return fmt.Sprintf("%T", source)
+}
+
 type ExpressionResolver[T comparable] struct {
-	sources []DataSource[T]
+	sources          []DataSource[T]
+	graph            dependencyGraph
+	costBased        bool
+	concurrency      int
+	conflictPolicies map[FieldName]ConflictPolicy
+	cache            EntityCache[T]
+	policies         map[string]SourcePolicy
+	breakers         map[string]*circuitBreaker
+	degrade          bool
+	streamBatchSize  int
 }
 
-func NewExpressionResolver[T comparable](sources []DataSource[T]) *ExpressionResolver[T] {
-	return &ExpressionResolver[T]{sources: sources}
+/*
+Option configures an ExpressionResolver
+*/
+type Option[T comparable] func(*ExpressionResolver[T])
+
+/*
+WithConcurrency limits how many calls to sources, including each batch, can run at the same time.
+A limit lower than 1 means no limit, which is the default.
+*/
+func WithConcurrency[T comparable](limit int) Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.concurrency = limit
+	}
+}
+
+/*
+NewExpressionResolver builds a resolver over the sources.
+It fails if two sources share a name, or if they declare required fields that depend on each other in a cycle.
+*/
+func NewExpressionResolver[T comparable](sources []DataSource[T], opts ...Option[T]) (*ExpressionResolver[T], error) {
+	names := map[string]struct{}{}
+	for _, source := range sources {
+		name := sourceName(source)
+		if _, ok := names[name]; ok {
+			return nil, DataSourceNameError{Name: name}
+		}
+		names[name] = struct{}{}
+	}
+
+	graph, err := newDependencyGraph(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &ExpressionResolver[T]{
+		sources:          sources,
+		graph:            graph,
+		conflictPolicies: map[FieldName]ConflictPolicy{},
+		policies:         map[string]SourcePolicy{},
+	}
+	for _, source := range sources {
+		if _, ok := source.(DataSourceStats); ok {
+			e.costBased = true
+		}
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.breakers = newCircuitBreakers(e.policies)
+
+	return e, nil
 }
 
 func (e *ExpressionResolver[T]) ProcessQuery(ctx context.Context, query QueryExpression, resultSchema ResultSchema) (
@@ -39,76 +158,304 @@ func (e *ExpressionResolver[T]) ProcessQuery(ctx context.Context, query QueryExp
 	bool,
 	error,
 ) {
-	finalEntities := Entities[T]{}
+	f := e.newFetcher()
+	entities, affected, err := e.resolveClauses(ctx, f, query)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entities, incomplete, err := e.buildResultSchema(ctx, f, entities, resultSchema)
+	if err != nil {
+		return nil, false, err
+	}
+	for id := range incomplete {
+		affected[id] = struct{}{}
+	}
+
+	return e.degradedResult(f, entities, affected)
+}
+
+// resolveClauses returns the entities matching any clause of the query,
+// along with the ones left undecided because of degraded sources
+func (e *ExpressionResolver[T]) resolveClauses(ctx context.Context, f *fetcher[T], query QueryExpression) (
+	Entities[T],
+	map[T]struct{},
+	error,
+) {
 	query = transform.ToDisjunctiveNormalForm(query)
-	for _, clause := range query.(*operator.Or).Terms {
-		entities, err := e.resolveQuery(ctx, clause.(*operator.And), Entities[T]{})
-		if err != nil {
-			return nil, false, err
-		}
+	clauses := query.(*operator.Or).Terms
+	results := make([]Entities[T], len(clauses))
+	undecided := make([]Entities[T], len(clauses))
+	err := forEachClause(ctx, clauses, func(ctx context.Context, i int, clause *operator.And) (err error) {
+		results[i], undecided[i], err = e.resolveQuery(ctx, f, clause, Entities[T]{}, false)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
+	finalEntities := Entities[T]{}
+	for _, entities := range results {
 		for id, e := range entities {
 			finalEntities[id] = e
 		}
 	}
 
-	return e.buildResultSchema(ctx, finalEntities, resultSchema)
+	// entities matched by any clause don't depend on the ones that couldn't be decided
+	affected := map[T]struct{}{}
+	for _, entities := range undecided {
+		for id := range entities {
+			if _, ok := finalEntities[id]; !ok {
+				affected[id] = struct{}{}
+			}
+		}
+	}
+
+	return finalEntities, affected, nil
+}
+
+// forEachClause runs fn for every clause concurrently, cancelling the rest on the first error
+func forEachClause(ctx context.Context, clauses []operator.Comparison, fn func(ctx context.Context, i int, clause *operator.And) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, clause := range clauses {
+		wg.Add(1)
+		go func(i int, clause *operator.And) {
+			defer wg.Done()
+
+			if err := fn(ctx, i, clause); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, clause.(*operator.And))
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// resolveQuery returns the entities matching the query.
+// When degrading gracefully, the ones left undecided because of degraded sources are returned apart.
+func (e *ExpressionResolver[T]) resolveQuery(ctx context.Context, f *fetcher[T], query *operator.And, entities Entities[T], enrich bool) (
+	Entities[T],
+	Entities[T],
+	error,
+) {
+	entities, declined, err := e.retrieveQueryFields(ctx, f, query, entities, enrich)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return e.filterEntitiesByQuery(f, query, entities, declined)
 }
 
-func (e *ExpressionResolver[T]) resolveQuery(ctx context.Context, query *operator.And, entities Entities[T]) (Entities[T], error) {
-	sources := make([]DataSource[T], len(e.sources))
-	copy(sources, e.sources)
+// retrieveQueryFields keeps asking the sources for fields until none of them can decorate the entities any further
+// it also returns the sources that never applied
+// when enriching, every source acts as an enricher, so only the given entities are decorated
+func (e *ExpressionResolver[T]) retrieveQueryFields(ctx context.Context, f *fetcher[T], query *operator.And, entities Entities[T], enrich bool) (
+	Entities[T],
+	[]DataSource[T],
+	error,
+) {
+	// sources that only decorate the entities they are given can't help unless they provide a field the query needs
+	neededFields := e.neededFields(query)
+	pending := []int{}
+	settled := map[int]struct{}{}
+	for _, source := range e.graph.order {
+		if (enrich || sourceRole(e.sources[source]) == EnricherRole) && !providesAny(e.sources[source], neededFields) {
+			settled[source] = struct{}{}
+			continue
+		}
+		pending = append(pending, source)
+	}
 
+	rejected := map[T]struct{}{}
+	declined := []DataSource[T]{}
 	retrievedFields := map[value.FieldName]struct{}{}
-	entitiesChanged := true
-	for entitiesChanged && len(sources) > 0 {
-		entitiesChanged = false
-		newSources := []DataSource[T]{}
-		for _, source := range sources {
-			retrievedEntities, applied, changed, err := e.retrieveEntities(ctx, retrievedFields, query, entities, source)
+	for round := 1; len(pending) > 0; round++ {
+		ready, waiting := []int{}, []int{}
+		for _, source := range pending {
+			if e.graph.isReady(source, settled) {
+				ready = append(ready, source)
+			} else {
+				waiting = append(waiting, source)
+			}
+		}
+
+		// sources whose dependencies were already consulted are independent of each other,
+		// so they are fetched concurrently and merged afterwards in topological order.
+		// When planning by cost, they are fetched one at a time instead, so each one can narrow down the entities
+		// sent to the next.
+		groups := e.fetchGroups(ready)
+		if e.costBased {
+			groups = [][]int{}
+			for _, source := range e.rankSources(query, ready) {
+				groups = append(groups, []int{source})
+			}
+		}
+
+		entitiesChanged := false
+		notApplied := []int{}
+		for _, group := range groups {
+			results, err := f.fetchSources(ctx, query, entities, group, enrich)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			if !applied {
-				newSources = append(newSources, source)
+
+			groupApplied := false
+			for i, source := range group {
+				// a source whose circuit is open won't come back during the query, so its fields stay unknown
+				if results[i].unavailable {
+					settled[source] = struct{}{}
+					declined = append(declined, e.sources[source])
+					continue
+				}
+				if !results[i].applied {
+					notApplied = append(notApplied, source)
+					continue
+				}
+
+				// entities already discarded by the planner must not come back
+				retrievedEntities := Entities[T]{}
+				for id, entity := range results[i].entities {
+					if _, ok := rejected[id]; !ok {
+						retrievedEntities[id] = entity
+					}
+				}
+
+				metadata := FieldMetadata{
+					Source:    sourceName(e.sources[source]),
+					FetchedAt: results[i].fetchedAt,
+					Round:     round,
+				}
+				changed, err := e.mergeEntities(retrievedFields, entities, retrievedEntities, e.sources[source], metadata)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				for _, fn := range e.sources[source].GetRetrievableFields() {
+					retrievedFields[fn] = struct{}{}
+				}
+				settled[source] = struct{}{}
+				entitiesChanged = entitiesChanged || changed
+				groupApplied = true
+			}
+
+			if !e.costBased || !groupApplied {
 				continue
 			}
 
-			for _, fn := range source.GetRetrievableFields() {
-				retrievedFields[fn] = struct{}{}
+			decided, err := pruneDecidedEntities(query, entities, rejected)
+			if err != nil {
+				return nil, nil, err
+			}
+			// there is no point in fetching more fields once every entity is decided,
+			// unless a producer could still bring new ones
+			if decided && e.producersSettled(settled) {
+				return entities, declined, nil
+			}
+		}
+
+		// if nothing changed, the sources that didn't apply won't do it later either,
+		// so we give up on them and let the ones depending on them try anyway
+		if !entitiesChanged {
+			for _, source := range notApplied {
+				settled[source] = struct{}{}
+				declined = append(declined, e.sources[source])
 			}
-			entities = retrievedEntities
-			entitiesChanged = entitiesChanged || changed
+			notApplied = nil
 		}
 
-		sources = newSources
+		pending = []int{}
+		for _, source := range e.graph.order {
+			if slices.Contains(notApplied, source) || slices.Contains(waiting, source) {
+				pending = append(pending, source)
+			}
+		}
 	}
 
-	return e.filterEntitiesByQuery(query, entities)
+	return entities, declined, nil
 }
 
-func (e *ExpressionResolver[T]) retrieveEntities(ctx context.Context, retrievedFields map[value.FieldName]struct{}, query *operator.And, entities Entities[T], source DataSource[T]) (
-	result Entities[T],
-	applied bool,
-	changed bool,
-	err error,
-) {
-	retrievedEntities, ok, err := source.RetrieveFields(ctx, query, entities)
-	if err != nil {
-		return nil, false, false, err
+// fetchGroups splits the ready sources in groups fetched one after the other, keeping their order.
+// Sources that declare neither a role nor dependencies may decorate whatever the sources before them retrieved,
+// so each of them is fetched on its own, and the rest are fetched together between them.
+func (e *ExpressionResolver[T]) fetchGroups(ready []int) [][]int {
+	groups := [][]int{}
+	group := []int{}
+	for _, source := range ready {
+		if declaresDependencies(e.sources[source]) {
+			group = append(group, source)
+			continue
+		}
+
+		if len(group) > 0 {
+			groups = append(groups, group)
+			group = []int{}
+		}
+		groups = append(groups, []int{source})
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// providesAny tells whether the source can retrieve any of the fields
+func providesAny[T comparable](source DataSource[T], fields map[FieldName]struct{}) bool {
+	for _, f := range source.GetRetrievableFields() {
+		if _, ok := fields[f]; ok {
+			return true
+		}
 	}
-	if !ok {
-		return entities, false, false, nil
+
+	return false
+}
+
+func (e *ExpressionResolver[T]) producersSettled(settled map[int]struct{}) bool {
+	for i, source := range e.sources {
+		if _, ok := settled[i]; !ok && sourceRole(source) == ProducerRole {
+			return false
+		}
 	}
 
+	return true
+}
+
+// mergeEntities decorates the entities with the fields retrieved by the source,
+// adding the ones that were not known yet
+func (e *ExpressionResolver[T]) mergeEntities(
+	retrievedFields map[value.FieldName]struct{},
+	entities Entities[T],
+	retrievedEntities Entities[T],
+	source DataSource[T],
+	metadata FieldMetadata,
+) (
+	changed bool,
+	err error,
+) {
 	for id := range retrievedEntities {
 		if _, ok := entities[id]; !ok {
 			entities[id] = NewEntity[T](id)
 		}
 	}
 
+	name := metadata.Source
+	omitted := metadata
+	omitted.Omitted = true
+	sourceFields := map[value.FieldName]struct{}{}
 	retrievableFields := map[value.FieldName]struct{}{}
 	for _, fn := range source.GetRetrievableFields() {
+		sourceFields[fn] = struct{}{}
 		retrievableFields[fn] = struct{}{}
 	}
 	for fn := range retrievedFields {
@@ -123,43 +470,117 @@ func (e *ExpressionResolver[T]) retrieveEntities(ctx context.Context, retrievedF
 		if !ok {
 			de = NewEntity(id)
 		}
+		// values served from the cache keep the time they were fetched at
+		incomingMetadata := func(f FieldName) FieldMetadata {
+			incoming := metadata
+			if cachedMetadata, ok := de.GetFieldMetadata(f); ok && !cachedMetadata.FetchedAt.IsZero() {
+				incoming.FetchedAt = cachedMetadata.FetchedAt
+			}
+			return incoming
+		}
 
 		// for each possible field, we check if it came in the decorated entity
-		// if it did, we add the field to the actual one
+		// if it did, we add the field to the actual one, resolving conflicts with the values other sources supplied
 		// if not, we just add an empty field to it
 		for f := range retrievableFields {
-			if de.FieldExists(f) != logic.Undefined && entity.FieldExists(f) == logic.Undefined {
+			_, own := sourceFields[f]
+			incoming := de.FieldExists(f)
+			switch entity.FieldExists(f) {
+			case logic.Undefined:
+				var v value.Value = value.Undefined{}
+				if incoming != logic.Undefined {
+					if v, err = de.SeekField(f); err != nil {
+						return false, err
+					}
+				}
+
+				if incoming != logic.Undefined {
+					entity.addRetrievedField(f, v, incomingMetadata(f))
+				} else if own {
+					entity.addRetrievedField(f, v, omitted)
+				} else {
+					entity.AddField(f, v)
+				}
+				entitiesChanged = true
+			case logic.False:
+				// a missing value is filled by any other source supplying it
+				if !own || incoming != logic.True {
+					continue
+				}
+
 				v, err := de.SeekField(f)
 				if err != nil {
-					return nil, false, false, err
+					return false, err
 				}
-				entity.AddField(f, v)
+				entity.addRetrievedField(f, v, incomingMetadata(f))
 				entitiesChanged = true
-				continue
-			} else if entity.FieldExists(f) == logic.Undefined {
-				entity.AddField(f, value.Undefined{})
-				entitiesChanged = true
-			}
+			case logic.True:
+				if !own || incoming != logic.True {
+					continue
+				}
+
+				current, _ := entity.SeekField(f)
+				v, err := de.SeekField(f)
+				if err != nil {
+					return false, err
+				}
+
+				currentSource, _ := entity.GetFieldSource(f)
+				resolved, err := e.conflictPolicy(f)(
+					f,
+					SourcedValue{Value: current, Source: currentSource},
+					SourcedValue{Value: v, Source: name},
+				)
+				if err != nil {
+					return false, err
+				}
 
+				if resolved.Source != currentSource {
+					resolvedMetadata := incomingMetadata(f)
+					resolvedMetadata.Source = resolved.Source
+					entity.addRetrievedField(f, resolved.Value, resolvedMetadata)
+					entitiesChanged = true
+				} else if tv, _ := resolved.Value.Equal(current); tv != logic.True {
+					// a custom merge may combine both values while keeping the current source
+					currentMetadata, _ := entity.GetFieldMetadata(f)
+					entity.addRetrievedField(f, resolved.Value, currentMetadata)
+					entitiesChanged = true
+				}
+			}
 		}
 
 		entities[id] = entity
 	}
 
-	return entities, true, entitiesChanged, nil
+	return entitiesChanged, nil
 }
 
-func (e *ExpressionResolver[T]) filterEntitiesByQuery(query *operator.And, entities Entities[T]) (Entities[T], error) {
-	newEntities := Entities[T]{}
-	for _, e := range entities {
-		// if an entity is unresolvalbe, then all of them are
-		if !query.IsResolvable(&e) {
-			return nil, ErrQueryExpressionUnsolvable
+func (e *ExpressionResolver[T]) filterEntitiesByQuery(f *fetcher[T], query *operator.And, entities Entities[T], declined []DataSource[T]) (
+	Entities[T],
+	Entities[T],
+	error,
+) {
+	newEntities, undecided := Entities[T]{}, Entities[T]{}
+	for _, entity := range entities {
+		if !query.IsResolvable(&entity) {
+			if e.degrade {
+				degraded, err := e.dependsOnDegradedSources(f, query, &entity, declined)
+				if err != nil {
+					return nil, nil, err
+				}
+				if degraded {
+					undecided[entity.id] = entity
+					continue
+				}
+			}
+
+			// if an entity is unresolvalbe, then all of them are
+			return nil, nil, newQueryExpressionUnsolvableError(query, &entity, declined)
 		}
 
-		ok, err := query.Resolve(&e)
+		ok, err := query.Resolve(&entity)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// If we got UNDEFINED or FALSE, then this entity does not apply
@@ -167,30 +588,88 @@ func (e *ExpressionResolver[T]) filterEntitiesByQuery(query *operator.And, entit
 			continue
 		}
 
-		newEntities[e.id] = e
+		newEntities[entity.id] = entity
+	}
+
+	return newEntities, undecided, nil
+}
+
+func newQueryExpressionUnsolvableError[T comparable](query *operator.And, entity operator.Entity, declined []DataSource[T]) error {
+	_, remaining, err := reduceQuery(query, entity)
+	if err != nil {
+		return err
+	}
+
+	missingFields := []FieldName{}
+	seenFields := map[FieldName]struct{}{}
+	for _, term := range remaining {
+		for _, f := range term.GetFieldNames() {
+			if _, ok := seenFields[f]; ok || entity.FieldExists(f) != logic.Undefined {
+				continue
+			}
+			seenFields[f] = struct{}{}
+			missingFields = append(missingFields, f)
+		}
+	}
+
+	declinedSources := []string{}
+	for _, source := range declined {
+		declinedSources = append(declinedSources, sourceName(source))
 	}
 
-	return newEntities, nil
+	return QueryExpressionUnsolvableError{
+		Clause:               query,
+		UnresolvedPredicates: remaining,
+		MissingFields:        missingFields,
+		DeclinedSources:      declinedSources,
+	}
 }
 
-func (e *ExpressionResolver[T]) buildResultSchema(ctx context.Context, entities Entities[T], resultSchema ResultSchema) (
+// buildResultSchema decorates the entities with the fields of the schema, and projects them to it
+func (e *ExpressionResolver[T]) buildResultSchema(ctx context.Context, f *fetcher[T], entities Entities[T], resultSchema ResultSchema) (
+	Entities[T],
 	Entities[T],
-	bool,
 	error,
 ) {
 	if len(entities) == 0 {
-		return nil, true, nil
+		return nil, nil, nil
 	}
 
-	terms := []operator.Comparison{}
-	for _, f := range resultSchema {
-		terms = append(terms, operator.NewExists(f))
+	entities, incomplete, err := e.retrieveResultSchema(ctx, f, entities, resultSchema)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	entities, err := e.resolveQuery(ctx, operator.NewAnd(terms...), entities)
+	return entities.projectResultSchema(resultSchema), incomplete, nil
+}
+
+// retrieveResultSchema decorates the entities with the fields of the schema, dropping the ones lacking a required field.
+// When degrading gracefully, entities missing fields of degraded sources are kept with the ones they have,
+// and returned apart as incomplete too.
+func (e *ExpressionResolver[T]) retrieveResultSchema(ctx context.Context, f *fetcher[T], entities Entities[T], resultSchema ResultSchema) (
+	Entities[T],
+	Entities[T],
+	error,
+) {
+	ids := map[T]struct{}{}
+	for id := range entities {
+		ids[id] = struct{}{}
+	}
+
+	entities, incomplete, err := e.resolveQuery(ctx, f, resultSchemaQuery(resultSchema, optionalFields(ctx)), entities, true)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, err
+	}
+	for id, entity := range incomplete {
+		entities[id] = entity
+	}
+
+	// sources may bring back entities that were already filtered out by the query, so we drop them
+	for id := range entities {
+		if _, ok := ids[id]; !ok {
+			delete(entities, id)
+		}
 	}
 
-	return entities.projectResultSchema(resultSchema), true, nil
+	return entities, incomplete, nil
 }
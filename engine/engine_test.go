@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+// decoratingSource is a bare DataSource that decorates the entities it receives, declaring nothing else
+type decoratingSource struct {
+	field FieldName
+	value value.Value
+}
+
+func (s decoratingSource) GetRetrievableFields() []FieldName {
+	return []FieldName{s.field}
+}
+
+func (s decoratingSource) RetrieveFields(ctx context.Context, query QueryExpression, entities Entities[int]) (Entities[int], bool, error) {
+	for _, entity := range entities {
+		entity.AddField(s.field, s.value)
+	}
+
+	return entities, true, nil
+}
+
+func TestUndeclaredSourcesSeeTheEntitiesRetrievedBeforeThem(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	decorator := decoratingSource{field: "b", value: value.NewInt64(10)}
+
+	e := newTestResolver(t, []DataSource[int]{producer, decorator})
+
+	query := operator.NewAnd(equal("a", value.NewInt64(1)), equal("b", value.NewInt64(10)))
+	entities, solved, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a", "b"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+	}
+}
+
+func TestQueryExpressionUnsolvableError(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(1)},
+	}}
+	declining := &testSource{name: "declining", role: EnricherRole, fields: []FieldName{"b"}, declines: true}
+
+	tests := []struct {
+		name       string
+		sources    []DataSource[int]
+		query      QueryExpression
+		predicates []string
+		missing    []FieldName
+		declined   []string
+	}{
+		{
+			name:       "field without source",
+			sources:    []DataSource[int]{producer},
+			query:      operator.NewAnd(equal("a", value.NewInt64(1)), equal("z", value.NewInt64(2))),
+			predicates: []string{equal("z", value.NewInt64(2)).String()},
+			missing:    []FieldName{"z"},
+			declined:   []string{},
+		},
+		{
+			name:       "declined source",
+			sources:    []DataSource[int]{producer, declining},
+			query:      operator.NewAnd(equal("a", value.NewInt64(1)), equal("b", value.NewInt64(2))),
+			predicates: []string{equal("b", value.NewInt64(2)).String()},
+			missing:    []FieldName{"b"},
+			declined:   []string{"declining"},
+		},
+		{
+			name:    "decided predicates are left out",
+			sources: []DataSource[int]{producer, declining},
+			query: operator.NewAnd(
+				equal("a", value.NewInt64(1)),
+				operator.NewOr(equal("a", value.NewInt64(2)), equal("b", value.NewInt64(3))),
+			),
+			predicates: []string{equal("b", value.NewInt64(3)).String()},
+			missing:    []FieldName{"b"},
+			declined:   []string{"declining"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestResolver(t, tt.sources)
+
+			_, solved, err := e.ProcessQuery(context.Background(), tt.query, ResultSchema{"a"})
+			if solved {
+				t.Error("ProcessQuery() solved = true, want false")
+			}
+			var unsolvable QueryExpressionUnsolvableError
+			if !errors.As(err, &unsolvable) || !errors.Is(err, ErrQueryExpressionUnsolvable) {
+				t.Fatalf("ProcessQuery() error = %v, want a QueryExpressionUnsolvableError", err)
+			}
+
+			predicates := []string{}
+			for _, p := range unsolvable.UnresolvedPredicates {
+				predicates = append(predicates, p.String())
+			}
+			if !slices.Equal(predicates, tt.predicates) {
+				t.Errorf("unresolved predicates = %v, want %v", predicates, tt.predicates)
+			}
+			if !slices.Equal(unsolvable.MissingFields, tt.missing) {
+				t.Errorf("missing fields = %v, want %v", unsolvable.MissingFields, tt.missing)
+			}
+			if !slices.Equal(unsolvable.DeclinedSources, tt.declined) {
+				t.Errorf("declined sources = %v, want %v", unsolvable.DeclinedSources, tt.declined)
+			}
+		})
+	}
+}
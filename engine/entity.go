@@ -2,6 +2,8 @@ package engine
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/ZarthaxX/query-resolver/logic"
 	"github.com/ZarthaxX/query-resolver/value"
@@ -9,26 +11,51 @@ import (
 
 type FieldName = string
 
+/*
+FieldMetadata tells how the engine retrieved a field of an entity.
+Omitted means the source was asked for the field but didn't return it, so its value is Undefined.
+*/
+type FieldMetadata struct {
+	Source    string
+	FetchedAt time.Time
+	Round     int
+	Omitted   bool
+}
+
 type Entity[T comparable] struct {
-	id     T
-	fields map[FieldName]value.Value
+	id       T
+	fields   map[FieldName]value.Value
+	metadata map[FieldName]FieldMetadata
 }
 
 func NewEntity[T comparable](id T) Entity[T] {
 	return Entity[T]{
-		id:     id,
-		fields: make(map[FieldName]value.Value),
+		id:       id,
+		fields:   make(map[FieldName]value.Value),
+		metadata: make(map[FieldName]FieldMetadata),
 	}
 }
 
 func NewEmptyEntity[T comparable]() *Entity[T] {
 	var id T
 	return &Entity[T]{
-		id:     id,
-		fields: make(map[FieldName]value.Value),
+		id:       id,
+		fields:   make(map[FieldName]value.Value),
+		metadata: make(map[FieldName]FieldMetadata),
 	}
 }
 
+func (e Entity[T]) GetID() T {
+	return e.id
+}
+
+/*
+GetAnyID returns the ID regardless of its type, for code that handles entities of any kind, like templates
+*/
+func (e Entity[T]) GetAnyID() any {
+	return e.id
+}
+
 func (e Entity[T]) SeekField(f FieldName) (value.Value, error) {
 	ef, ok := e.fields[FieldName(f)]
 	if !ok {
@@ -55,20 +82,73 @@ func (e *Entity[T]) AddField(name FieldName, value value.Value) {
 	e.fields[name] = value
 }
 
+// GetFieldSource returns the name of the source that supplied the field, if the engine retrieved it
+func (e Entity[T]) GetFieldSource(f FieldName) (string, bool) {
+	metadata, ok := e.metadata[f]
+	return metadata.Source, ok
+}
+
+// GetFieldMetadata returns how the field was retrieved, if the engine retrieved it
+func (e Entity[T]) GetFieldMetadata(f FieldName) (FieldMetadata, bool) {
+	metadata, ok := e.metadata[f]
+	return metadata, ok
+}
+
+func (e *Entity[T]) addRetrievedField(name FieldName, value value.Value, metadata FieldMetadata) {
+	e.fields[name] = value
+	e.metadata[name] = metadata
+}
+
+// clone copies the entity, so the copy can be decorated without affecting it
+func (e Entity[T]) clone() Entity[T] {
+	c := NewEntity(e.id)
+	for f, v := range e.fields {
+		c.fields[f] = v
+	}
+	for f, metadata := range e.metadata {
+		c.metadata[f] = metadata
+	}
+
+	return c
+}
+
 func (e *Entity[T]) projectResultSchema(schema ResultSchema) Entity[T] {
-	schemaEntity := NewEmptyEntity[T]()
+	schemaEntity := NewEntity(e.id)
 	for _, f := range schema {
 		if e.FieldExists(f) != logic.Undefined {
 			v, _ := e.SeekField(f)
-			schemaEntity.AddField(f, v)
+			if metadata, ok := e.GetFieldMetadata(f); ok {
+				schemaEntity.addRetrievedField(f, v, metadata)
+			} else {
+				schemaEntity.AddField(f, v)
+			}
 		}
 	}
 
-	return *schemaEntity
+	return schemaEntity
 }
 
 type Entities[T comparable] map[T]Entity[T]
 
+// sortableIDs returns a representation of each ID to order them by, since IDs are only comparable
+func sortableIDs[T comparable](ids []T) map[T]string {
+	keys := make(map[T]string, len(ids))
+	for _, id := range ids {
+		keys[id] = fmt.Sprintf("%#v", id)
+	}
+
+	return keys
+}
+
+func (e Entities[T]) clone() Entities[T] {
+	c := Entities[T]{}
+	for id, entity := range e {
+		c[id] = entity.clone()
+	}
+
+	return c
+}
+
 func (e *Entities[T]) projectResultSchema(schema ResultSchema) Entities[T] {
 	schemaEntities := Entities[T]{}
 	for k, v := range *e {
@@ -0,0 +1,456 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"golang.org/x/exp/maps"
+)
+
+type fetchResult[T comparable] struct {
+	entities    Entities[T]
+	applied     bool
+	unavailable bool
+	fetchedAt   time.Time
+}
+
+type fetchCall[T comparable] struct {
+	done   chan struct{}
+	result fetchResult[T]
+	err    error
+}
+
+/*
+fetcher is the fetch layer shared by every clause of a query.
+It is safe for concurrent use, limits how many calls to sources are running at the same time,
+and deduplicates identical calls, so clauses asking a source for the same thing only hit it once.
+*/
+type fetcher[T comparable] struct {
+	sources   []DataSource[T]
+	cache     EntityCache[T]
+	policies  map[string]SourcePolicy
+	breakers  map[string]*circuitBreaker
+	degrade   bool
+	orderBy   []OrderBy
+	semaphore chan struct{}
+
+	mu       sync.Mutex
+	calls    map[string]*fetchCall[T]
+	degraded map[string]error
+}
+
+func (e *ExpressionResolver[T]) newFetcher() *fetcher[T] {
+	f := &fetcher[T]{
+		sources:  e.sources,
+		cache:    e.cache,
+		policies: e.policies,
+		breakers: e.breakers,
+		degrade:  e.degrade,
+		calls:    map[string]*fetchCall[T]{},
+		degraded: map[string]error{},
+	}
+	if e.concurrency > 0 {
+		f.semaphore = make(chan struct{}, e.concurrency)
+	}
+
+	return f
+}
+
+// fetchSources retrieves the fields of the given sources concurrently.
+// Results keep the order of the sources, and the first error cancels the rest of the calls.
+func (f *fetcher[T]) fetchSources(ctx context.Context, query *operator.And, entities Entities[T], sources []int, enrich bool) (
+	[]fetchResult[T],
+	error,
+) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	results := make([]fetchResult[T], len(sources))
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source int) {
+			defer wg.Done()
+
+			result, err := f.fetch(ctx, query, entities, source, enrich)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+
+			results[i] = result
+		}(i, source)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return results, nil
+}
+
+// fetch calls the source with the part of the query it can push down,
+// unless an identical call was already made, in which case its result is shared.
+// When enriching, sources are not asked again for the entities they already decorated.
+func (f *fetcher[T]) fetch(ctx context.Context, query *operator.And, entities Entities[T], source int, enrich bool) (fetchResult[T], error) {
+	if enrich {
+		entities = undecoratedEntities(entities, f.sources[source])
+	}
+
+	enricher := enrich || sourceRole(f.sources[source]) == EnricherRole
+	if enricher {
+		query = operator.NewAnd()
+	} else {
+		query = pushdownQuery(f.sources[source], query)
+	}
+	required := []FieldName{}
+	if dependent, ok := f.sources[source].(DataSourceDependencies); ok {
+		required = dependent.GetRequiredFields()
+	}
+	key := fetchKey(query, entities, source, enricher, required)
+
+	f.mu.Lock()
+	call, ok := f.calls[key]
+	if ok {
+		f.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return fetchResult[T]{}, ctx.Err()
+		}
+	}
+	call = &fetchCall[T]{done: make(chan struct{})}
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	defer close(call.done)
+
+	call.result, call.err = f.retrieveFields(ctx, query, entities, f.sources[source], enricher)
+
+	return call.result, call.err
+}
+
+func (f *fetcher[T]) retrieveFields(ctx context.Context, query *operator.And, entities Entities[T], source DataSource[T], enricher bool) (
+	fetchResult[T],
+	error,
+) {
+	// enrichers are only asked for the entity and field pairs missing in the cache
+	requests, cached := []fetchRequest[T]{{entities: entities}}, Entities[T]{}
+	if enricher && f.cache != nil {
+		requests, cached = f.splitCachedEntities(entities, source)
+	}
+
+	// there is nothing to decorate, so there is no need to bother the enricher
+	if enricher && (len(entities) == 0 || len(requests) == 0) {
+		return fetchResult[T]{entities: cached, applied: true, fetchedAt: time.Now()}, nil
+	}
+
+	name := sourceName(source)
+	if !f.breakers[name].allow() {
+		f.markDegraded(name, ErrCircuitOpen)
+		return fetchResult[T]{unavailable: true}, nil
+	}
+
+	if !enricher {
+		ctx = withOrderByHint(ctx, source, f.orderBy)
+	}
+
+	retrievedEntities, applied, err := f.retrieveBatches(ctx, query, requests, source)
+	// the failure that opens the circuit already makes the source unavailable,
+	// and when degrading gracefully any failure does
+	if err != nil && ctx.Err() == nil && (f.degrade || f.breakers[name].isOpen()) {
+		f.markDegraded(name, err)
+		return fetchResult[T]{unavailable: true}, nil
+	}
+	if err != nil {
+		return fetchResult[T]{}, err
+	}
+	if !applied {
+		return fetchResult[T]{}, nil
+	}
+	fetchedAt := time.Now()
+
+	// enrichers must not materialize entities
+	if enricher {
+		for id := range retrievedEntities {
+			if _, ok := entities[id]; !ok {
+				delete(retrievedEntities, id)
+			}
+		}
+	}
+
+	if f.cache != nil {
+		for id, entity := range retrievedEntities {
+			for _, fn := range source.GetRetrievableFields() {
+				if v, err := entity.SeekField(fn); err == nil {
+					f.cache.Set(name, id, fn, CachedValue{Value: v, FetchedAt: fetchedAt})
+				}
+			}
+		}
+	}
+
+	// cached fields fill in whatever the source didn't retrieve again
+	for id, entity := range cached {
+		retrievedEntity, ok := retrievedEntities[id]
+		if !ok {
+			retrievedEntities[id] = entity
+			continue
+		}
+
+		for fn := range entity.fields {
+			if retrievedEntity.FieldExists(fn) == logic.Undefined {
+				v, _ := entity.SeekField(fn)
+				metadata, _ := entity.GetFieldMetadata(fn)
+				retrievedEntity.addRetrievedField(fn, v, metadata)
+			}
+		}
+	}
+
+	return fetchResult[T]{
+		entities:  retrievedEntities,
+		applied:   true,
+		fetchedAt: fetchedAt,
+	}, nil
+}
+
+// fetchRequest is a set of entities to retrieve fields for from a source.
+// fields are the ones still needed when the rest are cached, or nil when all of them are.
+type fetchRequest[T comparable] struct {
+	entities Entities[T]
+	fields   []FieldName
+}
+
+// retrieveBatches splits the entities of each request in batches as the source policy says,
+// and retrieves them concurrently. The source applies only if it applied to every batch.
+func (f *fetcher[T]) retrieveBatches(ctx context.Context, query *operator.And, requests []fetchRequest[T], source DataSource[T]) (
+	Entities[T],
+	bool,
+	error,
+) {
+	batches := []fetchRequest[T]{}
+	for _, request := range requests {
+		for _, batch := range splitBatches(request.entities, f.policies[sourceName(source)].BatchSize) {
+			batches = append(batches, fetchRequest[T]{entities: batch, fields: request.fields})
+		}
+	}
+	if len(batches) == 1 {
+		return f.callSource(ctx, query, batches[0], source)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	results := make([]fetchResult[T], len(batches))
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch fetchRequest[T]) {
+			defer wg.Done()
+
+			retrievedEntities, applied, err := f.callSource(ctx, query, batch, source)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+
+			results[i] = fetchResult[T]{
+				entities: retrievedEntities,
+				applied:  applied,
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, false, firstErr
+	}
+
+	retrievedEntities := Entities[T]{}
+	for _, result := range results {
+		if !result.applied {
+			return nil, false, nil
+		}
+
+		for id, entity := range result.entities {
+			retrievedEntities[id] = entity
+		}
+	}
+
+	return retrievedEntities, true, nil
+}
+
+// callSource retrieves the fields from the source once there is room for another call,
+// following the timeout and retries of its policy and recording the outcome in its circuit breaker
+func (f *fetcher[T]) callSource(ctx context.Context, query *operator.And, request fetchRequest[T], source DataSource[T]) (
+	Entities[T],
+	bool,
+	error,
+) {
+	if f.semaphore != nil {
+		select {
+		case f.semaphore <- struct{}{}:
+			defer func() { <-f.semaphore }()
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	var (
+		retrievedEntities Entities[T]
+		applied           bool
+	)
+	if request.fields != nil {
+		ctx = context.WithValue(ctx, requestedFieldsKey{}, request.fields)
+	}
+
+	name := sourceName(source)
+	err := f.policies[name].attempt(ctx, func(ctx context.Context) (err error) {
+		// each call gets its own deep copy, so sources decorating their input can't interfere with each other
+		// nor with the entities the engine keeps
+		retrievedEntities, applied, err = source.RetrieveFields(ctx, query, request.entities.clone())
+		return err
+	})
+	// the caller giving up says nothing about the health of the source
+	if err != nil && ctx.Err() != nil {
+		f.breakers[name].abort()
+		return nil, false, err
+	}
+	f.breakers[name].record(err)
+
+	return retrievedEntities, applied, err
+}
+
+// splitBatches splits the entities in batches of at most size entities, always in the same way
+func splitBatches[T comparable](entities Entities[T], size int) []Entities[T] {
+	if size < 1 || len(entities) <= size {
+		return []Entities[T]{entities}
+	}
+
+	ids := maps.Keys(entities)
+	idKeys := sortableIDs(ids)
+	sort.Slice(ids, func(i, j int) bool {
+		return idKeys[ids[i]] < idKeys[ids[j]]
+	})
+
+	batches := []Entities[T]{}
+	for start := 0; start < len(ids); start += size {
+		batch := Entities[T]{}
+		for _, id := range ids[start:min(start+size, len(ids))] {
+			batch[id] = entities[id]
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// undecoratedEntities returns the entities the source didn't supply any field for yet
+func undecoratedEntities[T comparable](entities Entities[T], source DataSource[T]) Entities[T] {
+	name := sourceName(source)
+	undecorated := Entities[T]{}
+	for id, entity := range entities {
+		decorated := false
+		for _, fn := range source.GetRetrievableFields() {
+			if metadata, ok := entity.GetFieldMetadata(fn); ok && metadata.Source == name {
+				decorated = true
+				break
+			}
+		}
+
+		if !decorated {
+			undecorated[id] = entity
+		}
+	}
+
+	return undecorated
+}
+
+// splitCachedEntities builds the entities with the fields of the source found in the cache, keeping the time they were fetched at,
+// and groups the entities still missing some of them in requests by the fields they miss
+func (f *fetcher[T]) splitCachedEntities(entities Entities[T], source DataSource[T]) ([]fetchRequest[T], Entities[T]) {
+	name := sourceName(source)
+	requests := map[string]*fetchRequest[T]{}
+	cached := Entities[T]{}
+	for id, entity := range entities {
+		cachedEntity := NewEntity(id)
+		missing := []FieldName{}
+		for _, fn := range source.GetRetrievableFields() {
+			v, ok := f.cache.Get(name, id, fn)
+			if !ok {
+				missing = append(missing, fn)
+				continue
+			}
+			cachedEntity.addRetrievedField(fn, v.Value, FieldMetadata{FetchedAt: v.FetchedAt})
+		}
+
+		if len(cachedEntity.fields) > 0 {
+			cached[id] = cachedEntity
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		key := strings.Join(missing, ",")
+		request, ok := requests[key]
+		if !ok {
+			request = &fetchRequest[T]{entities: Entities[T]{}}
+			// the source is only told which fields are needed when it doesn't need to retrieve all of them
+			if len(missing) < len(source.GetRetrievableFields()) {
+				request.fields = missing
+			}
+			requests[key] = request
+		}
+		request.entities[id] = entity
+	}
+
+	keys := maps.Keys(requests)
+	sort.Strings(keys)
+	sorted := []fetchRequest[T]{}
+	for _, key := range keys {
+		sorted = append(sorted, *requests[key])
+	}
+
+	return sorted, cached
+}
+
+// fetchKey identifies a call by its source, role, query and the entities it is made for.
+// Sources may depend on the values of the fields they require, so those are part of it too,
+// while the rest of the fields known for each entity can't change what the source retrieves.
+func fetchKey[T comparable](query *operator.And, entities Entities[T], source int, enricher bool, required []FieldName) string {
+	ids := make([]string, 0, len(entities))
+	for id, entity := range entities {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%T:%#v", id, id)
+		for _, fn := range required {
+			if v, ok := entity.fields[fn]; ok {
+				fmt.Fprintf(&sb, ",%q=%T:%#v", fn, v, v.MustValue())
+			}
+		}
+		ids = append(ids, sb.String())
+	}
+	sort.Strings(ids)
+
+	return fmt.Sprintf("%d|%t|%s|%s", source, enricher, query, strings.Join(ids, ";"))
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestSourcesDontShareTheirInput(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	// both enrichers run in the same round, and mark the entities they receive
+	b := &testSource{name: "b", role: EnricherRole, fields: []FieldName{"b"}, mark: true, rows: map[int]row{
+		1: {"b": value.NewInt64(1)},
+		2: {"b": value.NewInt64(2)},
+	}}
+	c := &testSource{name: "c", role: EnricherRole, fields: []FieldName{"c"}, mark: true, rows: map[int]row{
+		1: {"c": value.NewInt64(1)},
+		2: {"c": value.NewInt64(2)},
+	}}
+	// d runs afterwards, so it would see the marks if they leaked into the engine's entities
+	var leaked []FieldName
+	d := &testSource{name: "d", role: EnricherRole, fields: []FieldName{"d"}, required: []FieldName{"b", "c"},
+		seen: func(entities Entities[int]) {
+			for _, entity := range entities {
+				for fn := range entity.fields {
+					if fn == "b.mark" || fn == "c.mark" {
+						leaked = append(leaked, fn)
+					}
+				}
+			}
+		},
+		rows: map[int]row{
+			1: {"d": value.NewInt64(1)},
+			2: {"d": value.NewInt64(2)},
+		},
+	}
+
+	e := newTestResolver(t, []DataSource[int]{producer, b, c, d})
+	query := operator.NewAnd(operator.NewExists("a"), operator.NewExists("b"), operator.NewExists("c"), operator.NewExists("d"))
+	entities, solved, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1 2]", ids)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("fields written by sources leaked into the engine entities: %v", leaked)
+	}
+}
+
+func TestFetchDeduplicatesIdenticalCalls(t *testing.T) {
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"b"}, rows: map[int]row{
+		1: {"b": value.NewInt64(1)},
+		2: {"b": value.NewInt64(2)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{enricher})
+	f := e.newFetcher()
+
+	entities := Entities[int]{1: NewEntity(1), 2: NewEntity(2)}
+	for i := 0; i < 2; i++ {
+		if _, err := f.fetch(context.Background(), operator.NewAnd(), entities, 0, false); err != nil {
+			t.Fatalf("fetch() error = %v", err)
+		}
+	}
+	if n := enricher.callCount(); n != 1 {
+		t.Errorf("identical fetches called the source %d times, want 1", n)
+	}
+
+	// a call for other entities is a different call
+	if _, err := f.fetch(context.Background(), operator.NewAnd(), Entities[int]{2: NewEntity(2)}, 0, false); err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+	if n := enricher.callCount(); n != 2 {
+		t.Errorf("fetches for other entities called the source %d times, want 2", n)
+	}
+}
+
+func TestFetchKey(t *testing.T) {
+	withValues := func(id int, a, b int64) Entities[int] {
+		entity := NewEntity(id)
+		entity.AddField("a", value.NewInt64(a))
+		entity.AddField("b", value.NewInt64(b))
+		return Entities[int]{id: entity}
+	}
+	query := operator.NewAnd()
+	key := fetchKey(query, withValues(1, 1, 1), 0, true, []FieldName{"a"})
+
+	tests := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{name: "identical call", key: fetchKey(query, withValues(1, 1, 1), 0, true, []FieldName{"a"}), same: true},
+		{name: "other entities", key: fetchKey(query, withValues(2, 1, 1), 0, true, []FieldName{"a"})},
+		{name: "other required value", key: fetchKey(query, withValues(1, 2, 1), 0, true, []FieldName{"a"})},
+		{name: "other value not required", key: fetchKey(query, withValues(1, 1, 2), 0, true, []FieldName{"a"}), same: true},
+		{name: "other source", key: fetchKey(query, withValues(1, 1, 1), 1, true, []FieldName{"a"})},
+		{name: "other role", key: fetchKey(query, withValues(1, 1, 1), 0, false, []FieldName{"a"})},
+		{name: "other query", key: fetchKey(exists("a"), withValues(1, 1, 1), 0, true, []FieldName{"a"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.key == key; same != tt.same {
+				t.Errorf("fetchKey() = %q, compared to %q same = %t, want %t", tt.key, key, same, tt.same)
+			}
+		})
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	entities := Entities[int]{}
+	for id := 1; id <= 5; id++ {
+		entities[id] = NewEntity(id)
+	}
+
+	tests := []struct {
+		name string
+		size int
+		want [][]int
+	}{
+		{name: "no size", size: 0, want: [][]int{{1, 2, 3, 4, 5}}},
+		{name: "larger than entities", size: 5, want: [][]int{{1, 2, 3, 4, 5}}},
+		{name: "uneven", size: 2, want: [][]int{{1, 2}, {3, 4}, {5}}},
+		{name: "one per batch", size: 1, want: [][]int{{1}, {2}, {3}, {4}, {5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// batches are always split the same way
+			for i := 0; i < 3; i++ {
+				batches := splitBatches(entities, tt.size)
+				got := [][]int{}
+				for _, batch := range batches {
+					got = append(got, sortedIDs(batch))
+				}
+				if !slices.EqualFunc(got, tt.want, slices.Equal[[]int]) {
+					t.Fatalf("splitBatches() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// concurrentSource is a testSource that records how many of its calls ran at the same time
+type concurrentSource struct {
+	*testSource
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (s *concurrentSource) RetrieveFields(ctx context.Context, query QueryExpression, entities Entities[int]) (Entities[int], bool, error) {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if running <= peak || s.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+
+	return s.testSource.RetrieveFields(ctx, query, entities)
+}
+
+func TestWithConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{name: "one call", limit: 1},
+		{name: "two calls", limit: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{}}
+			rows := map[int]row{}
+			for id := 1; id <= 6; id++ {
+				producer.rows[id] = row{"a": value.NewInt64(int64(id))}
+				rows[id] = row{"b": value.NewInt64(int64(id))}
+			}
+			enricher := &concurrentSource{testSource: &testSource{
+				name: "enricher", role: EnricherRole, fields: []FieldName{"b"}, rows: rows, delay: 5 * time.Millisecond,
+			}}
+			e := newTestResolver(t, []DataSource[int]{producer, enricher},
+				WithConcurrency[int](tt.limit),
+				WithSourcePolicy[int]("enricher", SourcePolicy{BatchSize: 1}),
+			)
+
+			entities, solved, err := e.ProcessQuery(context.Background(), exists("b"), ResultSchema{"a", "b"})
+			if err != nil || !solved {
+				t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+			}
+			if ids := sortedIDs(entities); !slices.Equal(ids, []int{1, 2, 3, 4, 5, 6}) {
+				t.Errorf("ProcessQuery() ids = %v, want [1 2 3 4 5 6]", ids)
+			}
+			if peak := enricher.peak.Load(); peak > int32(tt.limit) {
+				t.Errorf("%d batches ran at the same time, want at most %d", peak, tt.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortDirection string
+
+const (
+	Ascending  SortDirection = "asc"
+	Descending SortDirection = "desc"
+)
+
+/*
+UndefinedPlacement tells where entities without a value for the ordering field go, no matter the direction
+*/
+type UndefinedPlacement string
+
+const (
+	UndefinedLast  UndefinedPlacement = "last"
+	UndefinedFirst UndefinedPlacement = "first"
+)
+
+/*
+OrderBy sorts entities by a field. The field doesn't need to be part of the result schema.
+Direction defaults to Ascending and Undefined to UndefinedLast.
+*/
+type OrderBy struct {
+	Field     FieldName
+	Direction SortDirection
+	Undefined UndefinedPlacement
+}
+
+/*
+QueryOptions configures which entities of the result are returned, and in which order.
+Entities are sorted by each OrderBy in turn, and then by their ID, so pages are stable across calls.
+Pages retrieved a chunk at a time from an IncrementalDataSource are the exception: ties keep the order of the source.
+Limit bounds the size of the page, 0 meaning no limit. The page starts at Offset,
+unless Cursor is set to the NextCursor of a previous page.
+A cursor only continues pages retrieved the same way, so it fails with ErrInvalidCursor otherwise.
+*/
+type QueryOptions struct {
+	OrderBy []OrderBy
+	Limit   int
+	Offset  int
+	Cursor  string
+}
+
+/*
+Page is a window of the sorted result of a query.
+NextCursor is empty when there are no more entities after the page.
+*/
+type Page[T comparable] struct {
+	Entities   []Entity[T]
+	NextCursor string
+}
+
+/*
+SortableDataSource can be implemented by a producer able to retrieve its entities sorted by some fields.
+When a page is ordered only by those fields, the source receives the ordering as a hint through the context,
+available with OrderByFromContext. The engine sorts the result anyway.
+*/
+type SortableDataSource interface {
+	GetSortableFields() []FieldName
+}
+
+type orderByKey struct{}
+
+/*
+OrderByFromContext returns the ordering of the page being retrieved, if the source was given one
+*/
+func OrderByFromContext(ctx context.Context) ([]OrderBy, bool) {
+	orderBy, ok := ctx.Value(orderByKey{}).([]OrderBy)
+	return orderBy, ok
+}
+
+// withOrderByHint adds the ordering to the context of producers that can sort by every field of it
+func withOrderByHint[T comparable](ctx context.Context, source DataSource[T], orderBy []OrderBy) context.Context {
+	sortable, ok := source.(SortableDataSource)
+	if !ok || len(orderBy) == 0 {
+		return ctx
+	}
+
+	for _, o := range orderBy {
+		if !slices.Contains(sortable.GetSortableFields(), o.Field) {
+			return ctx
+		}
+	}
+
+	return context.WithValue(ctx, orderByKey{}, orderBy)
+}
+
+/*
+ProcessQueryPage works like ProcessQuery, but returns the matching entities sorted, and only the ones in the page.
+Pages with a Limit are retrieved a chunk at a time from an IncrementalDataSource, if the engine can.
+*/
+func (e *ExpressionResolver[T]) ProcessQueryPage(ctx context.Context, query QueryExpression, resultSchema ResultSchema, opts QueryOptions) (
+	Page[T],
+	bool,
+	error,
+) {
+	if producer, source, ok := e.incrementalSource(opts); ok {
+		return e.processQueryTopK(ctx, query, resultSchema, opts, producer, source)
+	}
+
+	start, err := opts.start()
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+
+	f := e.newFetcher()
+	f.orderBy = opts.OrderBy
+	entities, affected, err := e.resolveClauses(ctx, f, query)
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+
+	keys, err := e.retrieveSortKeys(ctx, f, entities, opts.OrderBy)
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+
+	// entities lacking a required field of the schema are not part of the result, so those fields are retrieved
+	// for every match, while the rest of the schema is only built for the entities in the page
+	optional := optionalFields(ctx)
+	required := ResultSchema{}
+	for _, f := range resultSchema {
+		if _, ok := optional[f]; !ok {
+			required = append(required, f)
+		}
+	}
+	entities, incomplete, err := e.retrieveResultSchema(ctx, f, entities, required)
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+	for id := range incomplete {
+		affected[id] = struct{}{}
+	}
+
+	ids, err := sortEntityIDs(entities, keys, opts.OrderBy)
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+
+	end := len(ids)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	pageEntities := Entities[T]{}
+	for _, id := range ids[min(start, len(ids)):max(start, end)] {
+		pageEntities[id] = entities[id]
+	}
+	pageEntities, incomplete, err = e.buildResultSchema(ctx, f, pageEntities, resultSchema)
+	if err != nil {
+		return Page[T]{}, false, err
+	}
+	for id := range incomplete {
+		affected[id] = struct{}{}
+	}
+
+	page := Page[T]{Entities: []Entity[T]{}}
+	for _, id := range ids[min(start, len(ids)):max(start, end)] {
+		page.Entities = append(page.Entities, pageEntities[id])
+	}
+	if end < len(ids) {
+		page.NextCursor = encodeCursor(pageCursor{Mode: offsetCursor, Offset: end})
+	}
+
+	_, solved, err := e.degradedResult(f, entities, affected)
+	return page, solved, err
+}
+
+func (o QueryOptions) start() (int, error) {
+	if o.Cursor == "" {
+		return max(o.Offset, 0), nil
+	}
+
+	position, err := decodeCursor(o.Cursor, offsetCursor)
+	return position.Offset, err
+}
+
+// cursorMode tells how a page was retrieved, since a cursor can only continue pages retrieved the same way
+type cursorMode string
+
+const (
+	offsetCursor cursorMode = "offset"
+	chunkCursor  cursorMode = "chunk"
+)
+
+// pageCursor is where the next page starts: an offset in the sorted result,
+// or a position in the chunks of an IncrementalDataSource
+type pageCursor struct {
+	Mode   cursorMode `json:"mode"`
+	Offset int        `json:"offset,omitempty"`
+	Source string     `json:"source,omitempty"`
+	Skip   int        `json:"skip,omitempty"`
+	Chunk  int        `json:"chunk,omitempty"`
+}
+
+func encodeCursor(position pageCursor) string {
+	raw, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor rejects cursors of pages retrieved another way, and chunked ones without a chunk size
+func decodeCursor(cursor string, mode cursorMode) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, cursor)
+	}
+
+	var position pageCursor
+	if err := json.Unmarshal(raw, &position); err != nil || position.Offset < 0 || position.Skip < 0 || position.Chunk < 0 {
+		return pageCursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, cursor)
+	}
+	if position.Mode != mode || (mode == chunkCursor && position.Chunk == 0) {
+		return pageCursor{}, fmt.Errorf("%w: %s", ErrInvalidCursor, cursor)
+	}
+
+	return position, nil
+}
+
+// retrieveSortKeys retrieves the ordering fields of the entities, without filtering out the ones that lack them
+func (e *ExpressionResolver[T]) retrieveSortKeys(ctx context.Context, f *fetcher[T], entities Entities[T], orderBy []OrderBy) (
+	map[T][]value.Value,
+	error,
+) {
+	keys := map[T][]value.Value{}
+	if len(orderBy) == 0 || len(entities) == 0 {
+		return keys, nil
+	}
+
+	fields := []FieldName{}
+	for _, o := range orderBy {
+		fields = append(fields, o.Field)
+	}
+
+	entities, _, err := e.retrieveQueryFields(ctx, f, optionalFieldsQuery(fields), entities, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, entity := range entities {
+		for _, fn := range fields {
+			v := value.Value(value.Undefined{})
+			if entity.FieldExists(fn) == logic.True {
+				v, _ = entity.SeekField(fn)
+			}
+			keys[id] = append(keys[id], v)
+		}
+	}
+
+	return keys, nil
+}
+
+// sortEntityIDs sorts the entities by their keys, breaking ties by ID so the order is always the same
+func sortEntityIDs[T comparable](entities Entities[T], keys map[T][]value.Value, orderBy []OrderBy) ([]T, error) {
+	ids := []T{}
+	for id := range entities {
+		ids = append(ids, id)
+	}
+	idKeys := sortableIDs(ids)
+
+	var sortErr error
+	sort.SliceStable(ids, func(i, j int) bool {
+		for k, o := range orderBy {
+			c, err := compareSortKeys(keys[ids[i]][k], keys[ids[j]][k], o)
+			if err != nil && sortErr == nil {
+				sortErr = fmt.Errorf("ordering by %s: %w", o.Field, err)
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return idKeys[ids[i]] < idKeys[ids[j]]
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	return ids, nil
+}
+
+// compareSortKeys returns a negative number when a goes before b, a positive one when it goes after, and 0 otherwise
+func compareSortKeys(a, b value.Value, o OrderBy) (int, error) {
+	_, aDefined := valueOf(a)
+	_, bDefined := valueOf(b)
+	if !aDefined || !bDefined {
+		if aDefined == bDefined {
+			return 0, nil
+		}
+
+		c := 1
+		if o.Undefined == UndefinedFirst {
+			c = -1
+		}
+		if !bDefined {
+			c = -c
+		}
+		return c, nil
+	}
+
+	c := 0
+	if less, err := a.Less(b); err != nil {
+		return 0, err
+	} else if less == logic.True {
+		c = -1
+	} else if greater, err := b.Less(a); err != nil {
+		return 0, err
+	} else if greater == logic.True {
+		c = 1
+	}
+
+	if o.Direction == Descending {
+		c = -c
+	}
+	return c, nil
+}
+
+func valueOf(v value.Value) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	return v.Value()
+}
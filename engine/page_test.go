@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+// pageSources are a producer of four entities, and an enricher with the sort field of only two of them
+func pageSources() []DataSource[int] {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		0: {"a": value.NewInt64(0)},
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+		3: {"a": value.NewInt64(3)},
+	}}
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"s"}, rows: map[int]row{
+		0: {"s": value.NewInt64(20)},
+		2: {"s": value.NewInt64(10)},
+	}}
+
+	return []DataSource[int]{producer, enricher}
+}
+
+func TestProcessQueryPageOrdersEntities(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderBy []OrderBy
+		want    []int
+	}{
+		{name: "by id", want: []int{0, 1, 2, 3}},
+		{name: "descending", orderBy: []OrderBy{{Field: "a", Direction: Descending}}, want: []int{3, 2, 1, 0}},
+		{name: "undefined last", orderBy: []OrderBy{{Field: "s"}}, want: []int{2, 0, 1, 3}},
+		{name: "undefined first", orderBy: []OrderBy{{Field: "s", Undefined: UndefinedFirst}}, want: []int{1, 3, 2, 0}},
+		{
+			name:    "undefined first descending",
+			orderBy: []OrderBy{{Field: "s", Direction: Descending, Undefined: UndefinedFirst}},
+			want:    []int{1, 3, 0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestResolver(t, pageSources())
+			page, solved, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, QueryOptions{OrderBy: tt.orderBy})
+			if err != nil || !solved {
+				t.Fatalf("ProcessQueryPage() = %v, %v", solved, err)
+			}
+			if ids := pageIDs(page); !slices.Equal(ids, tt.want) {
+				t.Errorf("ProcessQueryPage() ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessQueryPageKeepsEntitiesWithoutSortKeyWhenPlanningByCost(t *testing.T) {
+	sources := []DataSource[int]{}
+	for _, source := range pageSources() {
+		sources = append(sources, statsSource{testSource: source.(*testSource), selectivity: 0.5})
+	}
+	e := newTestResolver(t, sources)
+
+	opts := QueryOptions{OrderBy: []OrderBy{{Field: "s", Undefined: UndefinedFirst}}}
+	page, _, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(page); !slices.Equal(ids, []int{1, 3, 2, 0}) {
+		t.Errorf("ProcessQueryPage() ids = %v, want [1 3 2 0]", ids)
+	}
+}
+
+func TestProcessQueryPageFollowsCursors(t *testing.T) {
+	e := newTestResolver(t, pageSources())
+	opts := QueryOptions{OrderBy: []OrderBy{{Field: "a"}}, Limit: 3}
+
+	first, _, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(first); !slices.Equal(ids, []int{0, 1, 2}) || first.NextCursor == "" {
+		t.Fatalf("first page = %v, cursor %q, want [0 1 2] and a cursor", ids, first.NextCursor)
+	}
+
+	opts.Cursor = first.NextCursor
+	second, _, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(second); !slices.Equal(ids, []int{3}) || second.NextCursor != "" {
+		t.Errorf("second page = %v, cursor %q, want [3] and no cursor", ids, second.NextCursor)
+	}
+
+	offset, _, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, QueryOptions{Offset: 2, Limit: 1})
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(offset); !slices.Equal(ids, []int{2}) {
+		t.Errorf("page at offset 2 = %v, want [2]", ids)
+	}
+}
+
+func TestProcessQueryPageRejectsInvalidCursors(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "malformed", cursor: "not a cursor"},
+		{name: "negative offset", cursor: encodeCursor(pageCursor{Mode: offsetCursor, Offset: -1})},
+		{name: "without mode", cursor: encodeCursor(pageCursor{Offset: 1})},
+		{name: "from chunks", cursor: encodeCursor(pageCursor{Mode: chunkCursor, Chunk: 2})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestResolver(t, pageSources())
+			_, _, err := e.ProcessQueryPage(context.Background(), exists("a"), ResultSchema{"a"}, QueryOptions{Cursor: tt.cursor})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ProcessQueryPage() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestProcessQueryPageEnrichesOnlyThePage(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantPage []int
+		// wantSeen are the entities the enricher of s received
+		wantSeen []int
+	}{
+		{name: "optional field", ctx: WithOptionalFields(context.Background(), "s"), wantPage: []int{0, 1}, wantSeen: []int{0, 1}},
+		{name: "required field", ctx: context.Background(), wantPage: []int{0, 2}, wantSeen: []int{0, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := pageSources()
+			e := newTestResolver(t, sources)
+			opts := QueryOptions{OrderBy: []OrderBy{{Field: "a"}}, Limit: 2}
+
+			page, _, err := e.ProcessQueryPage(tt.ctx, exists("a"), ResultSchema{"a", "s"}, opts)
+			if err != nil {
+				t.Fatalf("ProcessQueryPage() error = %v", err)
+			}
+			if ids := pageIDs(page); !slices.Equal(ids, tt.wantPage) {
+				t.Errorf("ProcessQueryPage() ids = %v, want %v", ids, tt.wantPage)
+			}
+
+			seen := []int{}
+			for _, call := range sources[1].(*testSource).calls {
+				seen = append(seen, sortedIDs(call)...)
+			}
+			slices.Sort(seen)
+			if !slices.Equal(seen, tt.wantSeen) {
+				t.Errorf("enricher received %v, want %v", seen, tt.wantSeen)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/transform"
+)
+
+/*
+PartialResult holds the outcome of a query that could not be fully solved.
+Matched entities satisfy the query for sure, while Undecided ones still depend on
+fields no source could provide. Remaining maps each undecided entity to the part
+of the query that is left to evaluate for it.
+*/
+type PartialResult[T comparable] struct {
+	Matched   Entities[T]
+	Undecided Entities[T]
+	Remaining map[T]QueryExpression
+}
+
+/*
+ProcessQueryPartially works like ProcessQuery, but instead of discarding every entity
+when a clause cannot be fully resolved, it returns what could be decided.
+If some entity is left undecided, a QueryExpressionPartiallySolvableError is returned
+along with the result, carrying the residual query of all undecided entities.
+*/
+func (e *ExpressionResolver[T]) ProcessQueryPartially(ctx context.Context, query QueryExpression, resultSchema ResultSchema) (
+	PartialResult[T],
+	error,
+) {
+	result := PartialResult[T]{
+		Matched:   Entities[T]{},
+		Undecided: Entities[T]{},
+		Remaining: map[T]QueryExpression{},
+	}
+
+	f := e.newFetcher()
+	query = transform.ToDisjunctiveNormalForm(query)
+	clauses := query.(*operator.Or).Terms
+	results := make([]Entities[T], len(clauses))
+	err := forEachClause(ctx, clauses, func(ctx context.Context, i int, clause *operator.And) (err error) {
+		results[i], _, err = e.retrieveQueryFields(ctx, f, clause, Entities[T]{}, false)
+		return err
+	})
+	if err != nil {
+		return PartialResult[T]{}, err
+	}
+
+	residuals := map[T][]operator.Comparison{}
+	for i, clause := range clauses {
+		for id, entity := range results[i] {
+			tv, remaining, err := reduceQuery(clause.(*operator.And), &entity)
+			if err != nil {
+				return PartialResult[T]{}, err
+			}
+
+			// a term that was resolved to FALSE or UNDEFINED can't be fixed by the remaining ones
+			if tv != logic.True {
+				continue
+			}
+
+			if len(remaining) == 0 {
+				result.Matched[id] = entity
+				continue
+			}
+
+			result.Undecided[id] = entity
+			residuals[id] = append(residuals[id], operator.NewAnd(remaining...))
+		}
+	}
+
+	// an entity matched by any clause is already part of the result, no matter the others
+	for id := range result.Matched {
+		delete(result.Undecided, id)
+		delete(residuals, id)
+	}
+
+	remainingClauses := []operator.Comparison{}
+	seenClauses := map[string]struct{}{}
+	for id, clauses := range residuals {
+		result.Remaining[id] = operator.NewOr(clauses...)
+		for _, c := range clauses {
+			if _, ok := seenClauses[c.String()]; ok {
+				continue
+			}
+			seenClauses[c.String()] = struct{}{}
+			remainingClauses = append(remainingClauses, c)
+		}
+	}
+	sort.Slice(remainingClauses, func(i, j int) bool {
+		return remainingClauses[i].String() < remainingClauses[j].String()
+	})
+
+	matched, _, err := e.buildResultSchema(ctx, f, result.Matched, resultSchema)
+	if err != nil {
+		return PartialResult[T]{}, err
+	}
+	if matched != nil {
+		result.Matched = matched
+	}
+	// undecided entities can't be filtered by the schema, so they only get the fields retrieved so far
+	result.Undecided = result.Undecided.projectResultSchema(resultSchema)
+
+	if len(result.Undecided) > 0 {
+		return result, QueryExpressionPartiallySolvableError{
+			RemainingQuery: operator.NewOr(remainingClauses...),
+		}
+	}
+
+	return result, nil
+}
+
+// reduceQuery resolves every term of the clause that can be resolved for the entity,
+// and returns the ones that still need more fields
+func reduceQuery(query *operator.And, entity operator.Entity) (logic.TruthValue, []operator.Comparison, error) {
+	res := logic.True
+	remaining := []operator.Comparison{}
+	for _, term := range query.Terms {
+		if !term.IsResolvable(entity) {
+			remaining = append(remaining, term)
+			continue
+		}
+
+		tv, err := term.Resolve(entity)
+		if err != nil {
+			return logic.Undefined, nil, err
+		}
+
+		res = res.And(tv)
+	}
+
+	return res, remaining, nil
+}
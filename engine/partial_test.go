@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestProcessQueryPartially(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+		3: {"a": value.NewInt64(3)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{producer})
+
+	// no source provides z, so entity 2 is left undecided while 3 is known not to match
+	query := operator.NewOr(
+		operator.NewAnd(equal("a", value.NewInt64(1))),
+		operator.NewAnd(equal("a", value.NewInt64(2)), equal("z", value.NewInt64(1))),
+	)
+	result, err := e.ProcessQueryPartially(context.Background(), query, ResultSchema{"a"})
+
+	var partial QueryExpressionPartiallySolvableError
+	if !errors.As(err, &partial) {
+		t.Fatalf("ProcessQueryPartially() error = %v, want a QueryExpressionPartiallySolvableError", err)
+	}
+	if want := "((@z = 1))"; partial.RemainingQuery.String() != want {
+		t.Errorf("remaining query = %s, want %s", partial.RemainingQuery, want)
+	}
+
+	if ids := sortedIDs(result.Matched); !slices.Equal(ids, []int{1}) {
+		t.Errorf("matched = %v, want [1]", ids)
+	}
+	if ids := sortedIDs(result.Undecided); !slices.Equal(ids, []int{2}) {
+		t.Errorf("undecided = %v, want [2]", ids)
+	}
+	if remaining := result.Remaining[2]; remaining == nil || remaining.String() != "((@z = 1))" {
+		t.Errorf("remaining query of entity 2 = %v, want ((@z = 1))", remaining)
+	}
+}
+
+func TestProcessQueryPartiallySolved(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{producer})
+
+	result, err := e.ProcessQueryPartially(context.Background(), exists("a"), ResultSchema{"a"})
+	if err != nil {
+		t.Fatalf("ProcessQueryPartially() error = %v", err)
+	}
+	if ids := sortedIDs(result.Matched); !slices.Equal(ids, []int{1, 2}) || len(result.Undecided) != 0 {
+		t.Errorf("matched = %v, undecided = %v, want [1 2] and none", ids, sortedIDs(result.Undecided))
+	}
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/transform"
+	"golang.org/x/exp/slices"
+)
+
+/*
+Plan describes what the engine would do to solve a query, without retrieving anything.
+*/
+type Plan struct {
+	Query        string       `json:"query"`
+	Clauses      []ClausePlan `json:"clauses"`
+	ResultSchema []PlanStep   `json:"result_schema"`
+}
+
+/*
+ClausePlan describes how a single DNF clause would be solved.
+LocalPredicates are not pushed down to any source, so only the engine evaluates them once their fields are retrieved,
+while UnresolvablePredicates need fields that no source provides.
+*/
+type ClausePlan struct {
+	Clause                 string     `json:"clause"`
+	Steps                  []PlanStep `json:"steps"`
+	LocalPredicates        []string   `json:"local_predicates"`
+	UnresolvablePredicates []string   `json:"unresolvable_predicates,omitempty"`
+}
+
+/*
+PlanStep is a source consultation, along with the fields it would contribute.
+*/
+type PlanStep struct {
+	Source      string      `json:"source"`
+	Role        Role        `json:"role"`
+	Fields      []FieldName `json:"fields"`
+	Requires    []FieldName `json:"requires,omitempty"`
+	Pushdown    []string    `json:"pushdown,omitempty"`
+	Cost        float64     `json:"cost,omitempty"`
+	Selectivity float64     `json:"selectivity,omitempty"`
+}
+
+/*
+Explain returns the plan the engine would follow to solve the query and build the result schema
+*/
+func (e *ExpressionResolver[T]) Explain(query QueryExpression, resultSchema ResultSchema) Plan {
+	plan := Plan{Query: query.String()}
+
+	query = transform.ToDisjunctiveNormalForm(query)
+	for _, clause := range query.(*operator.Or).Terms {
+		plan.Clauses = append(plan.Clauses, e.planClause(clause.(*operator.And)))
+	}
+
+	// optional fields are retrieved like the rest, so they don't change the plan
+	plan.ResultSchema = e.planFields(resultSchemaQuery(resultSchema, nil), true)
+
+	return plan
+}
+
+func (e *ExpressionResolver[T]) planClause(clause *operator.And) ClausePlan {
+	plan := ClausePlan{
+		Clause:          clause.String(),
+		Steps:           e.planFields(clause, false),
+		LocalPredicates: []string{},
+	}
+
+	providedFields := map[FieldName]struct{}{}
+	pushedDown := map[string]struct{}{}
+	for _, step := range plan.Steps {
+		for _, f := range step.Fields {
+			providedFields[f] = struct{}{}
+		}
+		for _, p := range step.Pushdown {
+			pushedDown[p] = struct{}{}
+		}
+	}
+
+	for _, term := range clause.Terms {
+		resolvable := true
+		for _, f := range term.GetFieldNames() {
+			if _, ok := providedFields[f]; !ok {
+				resolvable = false
+			}
+		}
+
+		if !resolvable {
+			plan.UnresolvablePredicates = append(plan.UnresolvablePredicates, term.String())
+		} else if _, ok := pushedDown[term.String()]; !ok {
+			plan.LocalPredicates = append(plan.LocalPredicates, term.String())
+		}
+	}
+
+	return plan
+}
+
+// planFields returns the sources in the topological order they would be consulted for the query,
+// each one contributing the needed fields that no previous source provided.
+// Fields required by the sources providing the ones of the query are needed too.
+// When planning by cost, sources at the same level are ordered by their rank for the query.
+// When enriching, sources only decorate known entities, so nothing is pushed down.
+func (e *ExpressionResolver[T]) planFields(query *operator.And, enrich bool) []PlanStep {
+	neededFields := e.neededFields(query)
+
+	order := make([]int, len(e.graph.order))
+	copy(order, e.graph.order)
+	if e.costBased {
+		order = e.rankSources(query, order)
+		sort.SliceStable(order, func(i, j int) bool {
+			return e.graph.levels[order[i]] < e.graph.levels[order[j]]
+		})
+	}
+
+	steps := []PlanStep{}
+	for _, i := range order {
+		source := e.sources[i]
+		step := PlanStep{
+			Source: sourceName(source),
+			Role:   sourceRole(source),
+			Fields: []FieldName{},
+		}
+		if dependent, ok := source.(DataSourceDependencies); ok {
+			step.Requires = dependent.GetRequiredFields()
+		}
+		if _, ok := source.(DataSourceCapabilities); ok && step.Role == ProducerRole && !enrich {
+			for _, term := range pushdownQuery(source, query).Terms {
+				step.Pushdown = append(step.Pushdown, term.String())
+			}
+		}
+		if stats, ok := source.(DataSourceStats); ok {
+			step.Cost = sourceCost(stats)
+			step.Selectivity = sourceSelectivity(stats, source.GetRetrievableFields(), query)
+		}
+		for _, f := range source.GetRetrievableFields() {
+			if _, ok := neededFields[f]; ok {
+				step.Fields = append(step.Fields, f)
+				delete(neededFields, f)
+			}
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps
+}
+
+// neededFields returns the fields of the query, along with the ones required to retrieve them, transitively
+func (e *ExpressionResolver[T]) neededFields(query *operator.And) map[FieldName]struct{} {
+	neededFields := map[FieldName]struct{}{}
+	pending := query.GetFieldNames()
+	for len(pending) > 0 {
+		f := pending[0]
+		pending = pending[1:]
+		if _, ok := neededFields[f]; ok {
+			continue
+		}
+		neededFields[f] = struct{}{}
+
+		for _, source := range e.sources {
+			dependent, ok := source.(DataSourceDependencies)
+			if ok && slices.Contains(source.GetRetrievableFields(), f) {
+				pending = append(pending, dependent.GetRequiredFields()...)
+			}
+		}
+	}
+
+	return neededFields
+}
+
+func (p Plan) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "query: %s\n", p.Query)
+	for i, c := range p.Clauses {
+		fmt.Fprintf(&sb, "clause %d: %s\n", i+1, c.Clause)
+		writePlanSteps(&sb, c.Steps)
+		fmt.Fprintf(&sb, "  local: %s\n", strings.Join(c.LocalPredicates, ", "))
+		if len(c.UnresolvablePredicates) > 0 {
+			fmt.Fprintf(&sb, "  unresolvable: %s\n", strings.Join(c.UnresolvablePredicates, ", "))
+		}
+	}
+
+	fmt.Fprintf(&sb, "result schema:\n")
+	writePlanSteps(&sb, p.ResultSchema)
+
+	return sb.String()
+}
+
+func (p Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "	")
+}
+
+func writePlanSteps(sb *strings.Builder, steps []PlanStep) {
+	for i, s := range steps {
+		fmt.Fprintf(sb, "  %d. %s (%s) -> [%s]", i+1, s.Source, s.Role, strings.Join(s.Fields, ", "))
+		if len(s.Requires) > 0 {
+			fmt.Fprintf(sb, " requires [%s]", strings.Join(s.Requires, ", "))
+		}
+		if len(s.Pushdown) > 0 {
+			fmt.Fprintf(sb, " pushdown [%s]", strings.Join(s.Pushdown, ", "))
+		}
+		if s.Cost > 0 || s.Selectivity > 0 {
+			fmt.Fprintf(sb, " cost %g selectivity %g", s.Cost, s.Selectivity)
+		}
+		fmt.Fprintln(sb)
+	}
+}
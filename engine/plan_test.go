@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+func planSources() []DataSource[int] {
+	orders := capableSource{
+		testSource: &testSource{name: "orders", fields: []FieldName{"a", "fk"}},
+		operators:  map[FieldName][]operator.ComparisonType{"a": {operator.EqualType}},
+	}
+	drivers := &testSource{name: "drivers", role: EnricherRole, fields: []FieldName{"d"}, required: []FieldName{"fk"}}
+	services := &testSource{name: "services", role: EnricherRole, fields: []FieldName{"b"}}
+
+	return []DataSource[int]{orders, drivers, services}
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        QueryExpression
+		resultSchema ResultSchema
+		want         Plan
+	}{
+		{
+			name:         "pushdown and local predicates",
+			query:        operator.NewAnd(equal("a", value.NewInt64(1)), equal("b", value.NewInt64(2))),
+			resultSchema: ResultSchema{"b"},
+			want: Plan{
+				Clauses: []ClausePlan{{
+					Steps: []PlanStep{
+						{Source: "orders", Role: ProducerRole, Fields: []FieldName{"a"}, Pushdown: []string{equal("a", value.NewInt64(1)).String()}},
+						{Source: "drivers", Role: EnricherRole, Fields: []FieldName{}, Requires: []FieldName{"fk"}},
+						{Source: "services", Role: EnricherRole, Fields: []FieldName{"b"}},
+					},
+					LocalPredicates: []string{equal("b", value.NewInt64(2)).String()},
+				}},
+				ResultSchema: []PlanStep{
+					{Source: "orders", Role: ProducerRole, Fields: []FieldName{}},
+					{Source: "drivers", Role: EnricherRole, Fields: []FieldName{}, Requires: []FieldName{"fk"}},
+					{Source: "services", Role: EnricherRole, Fields: []FieldName{"b"}},
+				},
+			},
+		},
+		{
+			name:         "dependency inputs",
+			query:        operator.NewAnd(equal("d", value.NewInt64(1))),
+			resultSchema: ResultSchema{"d"},
+			want: Plan{
+				Clauses: []ClausePlan{{
+					Steps: []PlanStep{
+						{Source: "orders", Role: ProducerRole, Fields: []FieldName{"fk"}},
+						{Source: "drivers", Role: EnricherRole, Fields: []FieldName{"d"}, Requires: []FieldName{"fk"}},
+						{Source: "services", Role: EnricherRole, Fields: []FieldName{}},
+					},
+					LocalPredicates: []string{equal("d", value.NewInt64(1)).String()},
+				}},
+				ResultSchema: []PlanStep{
+					{Source: "orders", Role: ProducerRole, Fields: []FieldName{"fk"}},
+					{Source: "drivers", Role: EnricherRole, Fields: []FieldName{"d"}, Requires: []FieldName{"fk"}},
+					{Source: "services", Role: EnricherRole, Fields: []FieldName{}},
+				},
+			},
+		},
+		{
+			name:         "unresolvable predicates",
+			query:        operator.NewAnd(equal("a", value.NewInt64(1)), equal("z", value.NewInt64(2))),
+			resultSchema: ResultSchema{"a"},
+			want: Plan{
+				Clauses: []ClausePlan{{
+					Steps: []PlanStep{
+						{Source: "orders", Role: ProducerRole, Fields: []FieldName{"a"}, Pushdown: []string{equal("a", value.NewInt64(1)).String()}},
+						{Source: "drivers", Role: EnricherRole, Fields: []FieldName{}, Requires: []FieldName{"fk"}},
+						{Source: "services", Role: EnricherRole, Fields: []FieldName{}},
+					},
+					LocalPredicates:        []string{},
+					UnresolvablePredicates: []string{equal("z", value.NewInt64(2)).String()},
+				}},
+				ResultSchema: []PlanStep{
+					{Source: "orders", Role: ProducerRole, Fields: []FieldName{"a"}},
+					{Source: "drivers", Role: EnricherRole, Fields: []FieldName{}, Requires: []FieldName{"fk"}},
+					{Source: "services", Role: EnricherRole, Fields: []FieldName{}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestResolver(t, planSources())
+
+			got := e.Explain(tt.query, tt.resultSchema)
+			tt.want.Query = tt.query.String()
+			tt.want.Clauses[0].Clause = tt.query.String()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Explain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	e := newTestResolver(t, planSources())
+	plan := e.Explain(operator.NewAnd(equal("a", value.NewInt64(1))), ResultSchema{"d"})
+
+	b, err := plan.JSON()
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+
+	var decoded Plan
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("decoding %s: %v", b, err)
+	}
+	if !reflect.DeepEqual(decoded, plan) {
+		t.Errorf("decoded plan = %+v, want %+v", decoded, plan)
+	}
+
+	// empty optional attributes are left out
+	var raw struct {
+		Clauses []struct {
+			Steps []map[string]any `json:"steps"`
+		} `json:"clauses"`
+		ResultSchema []map[string]any `json:"result_schema"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatalf("decoding %s: %v", b, err)
+	}
+	for _, attribute := range []string{"requires", "pushdown", "cost", "selectivity"} {
+		if _, ok := raw.Clauses[0].Steps[2][attribute]; ok {
+			t.Errorf("step %v has an empty %s", raw.Clauses[0].Steps[2], attribute)
+		}
+	}
+	if len(raw.ResultSchema) != 3 {
+		t.Errorf("result schema steps = %v, want 3", raw.ResultSchema)
+	}
+}
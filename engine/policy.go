@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+SourcePolicy configures how the engine calls a source.
+BatchSize splits the entities sent on each call into batches of at most that size, which are fetched concurrently.
+A BatchSize of 0 sends them all at once.
+
+Timeout bounds each attempt, on top of whatever deadline the caller context already has.
+Attempts failing with a retryable error are retried up to MaxRetries times, waiting Backoff before the first retry
+and doubling it before each of the next ones. Retryable decides which errors are retryable, defaulting to IsRetryable.
+
+After FailureThreshold consecutive failed calls the circuit of the source opens for OpenDuration.
+While it is open the source is unavailable: it is not called, its fields are left unknown,
+and the three-valued logic decides whether the query can still be answered without them.
+Once OpenDuration passes a single call is let through, closing the circuit again if it succeeds.
+A FailureThreshold of 0 disables the circuit breaker.
+*/
+type SourcePolicy struct {
+	BatchSize int
+
+	Timeout    time.Duration
+	MaxRetries int
+	Backoff    time.Duration
+	Retryable  func(error) bool
+
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+/*
+WithSourcePolicy sets the policy of the source with the given name
+*/
+func WithSourcePolicy[T comparable](source string, policy SourcePolicy) Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.policies[source] = policy
+	}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+/*
+Retryable marks an error returned by a source as worth retrying
+*/
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return retryableError{err: err}
+}
+
+/*
+IsRetryable tells if the error was marked with Retryable, or is an attempt that ran out of time
+*/
+func IsRetryable(err error) bool {
+	return errors.As(err, &retryableError{}) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (p SourcePolicy) isRetryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsRetryable(err)
+}
+
+// attempt calls fn until it succeeds, fails with an error that is not retryable, or runs out of retries
+func (p SourcePolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := p.Backoff
+	for retry := 0; ; retry++ {
+		err := p.call(ctx, fn)
+		// errors caused by the caller giving up are never retried
+		if err == nil || ctx.Err() != nil || retry >= p.MaxRetries || !p.isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (p SourcePolicy) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// circuitBreaker stops calling a source after too many consecutive failures, for as long as its policy says
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreakers(policies map[string]SourcePolicy) map[string]*circuitBreaker {
+	breakers := map[string]*circuitBreaker{}
+	for source, policy := range policies {
+		if policy.FailureThreshold > 0 {
+			breakers[source] = &circuitBreaker{
+				threshold:    policy.FailureThreshold,
+				openDuration: policy.OpenDuration,
+			}
+		}
+	}
+
+	return breakers
+}
+
+// allow tells if the source can be called, letting a single call through once the circuit stops being open
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.openDuration)
+	}
+}
+
+// abort lets another call through when the one being let through was given up by the caller
+func (b *circuitBreaker) abort() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures >= b.threshold && time.Now().Before(b.openUntil)
+}
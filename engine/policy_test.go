@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+// policySources are a producer of entities 1 and 2, and an enricher with the field f of both
+func policySources(enricher *testSource) []DataSource[int] {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+		1: {"a": value.NewInt64(1)},
+		2: {"a": value.NewInt64(2)},
+	}}
+	enricher.name, enricher.role, enricher.fields = "enricher", EnricherRole, []FieldName{"f"}
+	enricher.rows = map[int]row{
+		1: {"f": value.NewInt64(1)},
+		2: {"f": value.NewInt64(1)},
+	}
+
+	return []DataSource[int]{producer, enricher}
+}
+
+func TestSourcePolicyRetries(t *testing.T) {
+	flaky := &testSource{err: Retryable(errUnavailable), failures: 2}
+	e := newTestResolver(t, policySources(flaky),
+		WithSourcePolicy[int]("enricher", SourcePolicy{MaxRetries: 2, Backoff: time.Millisecond}))
+
+	entities, _, err := e.ProcessQuery(context.Background(), exists("f"), ResultSchema{"a"})
+	if err != nil {
+		t.Fatalf("ProcessQuery() error = %v", err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1 2]", ids)
+	}
+	if n := flaky.callCount(); n != 3 {
+		t.Errorf("source was called %d times, want 3", n)
+	}
+}
+
+func TestSourcePolicyDoesntRetryOtherErrors(t *testing.T) {
+	failing := &testSource{err: errUnavailable, failures: 1}
+	e := newTestResolver(t, policySources(failing),
+		WithSourcePolicy[int]("enricher", SourcePolicy{MaxRetries: 2}))
+
+	if _, _, err := e.ProcessQuery(context.Background(), exists("f"), ResultSchema{"a"}); !errors.Is(err, errUnavailable) {
+		t.Errorf("ProcessQuery() error = %v, want %v", err, errUnavailable)
+	}
+	if n := failing.callCount(); n != 1 {
+		t.Errorf("source was called %d times, want 1", n)
+	}
+}
+
+func TestSourcePolicyTimeout(t *testing.T) {
+	slow := &testSource{delay: time.Second}
+	e := newTestResolver(t, policySources(slow),
+		WithSourcePolicy[int]("enricher", SourcePolicy{Timeout: 10 * time.Millisecond, MaxRetries: 1}))
+
+	start := time.Now()
+	_, _, err := e.ProcessQuery(context.Background(), exists("f"), ResultSchema{"a"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ProcessQuery() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// attempts running out of time are retried
+	if n := slow.callCount(); n != 2 {
+		t.Errorf("source was called %d times, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("ProcessQuery() took %v, despite the timeout", elapsed)
+	}
+}
+
+func TestSourcePolicyCircuitBreaker(t *testing.T) {
+	down := &testSource{err: errUnavailable}
+	e := newTestResolver(t, policySources(down),
+		WithSourcePolicy[int]("enricher", SourcePolicy{FailureThreshold: 2, OpenDuration: 50 * time.Millisecond}))
+
+	// the query is decided without f, which the second clause only needs for entities it already rejects
+	query := operator.NewOr(
+		operator.NewAnd(equal("a", value.NewInt64(1))),
+		operator.NewAnd(equal("a", value.NewInt64(3)), operator.NewExists("f")),
+	)
+	if _, _, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"}); !errors.Is(err, errUnavailable) {
+		t.Fatalf("ProcessQuery() error = %v, want %v", err, errUnavailable)
+	}
+
+	// the failure opening the circuit, and every call while it is open, leave the fields of the source unknown
+	for i := 0; i < 2; i++ {
+		entities, _, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+		if err != nil {
+			t.Fatalf("ProcessQuery() error = %v", err)
+		}
+		if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+			t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+		}
+	}
+	if n := down.callCount(); n != 2 {
+		t.Errorf("source was called %d times while its circuit was open, want 2", n)
+	}
+
+	// after a while the source is given another chance
+	time.Sleep(60 * time.Millisecond)
+	e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if n := down.callCount(); n != 3 {
+		t.Errorf("source was called %d times after its circuit opened, want 3", n)
+	}
+}
+
+func TestSourcePolicyBatches(t *testing.T) {
+	enricher := &testSource{}
+	e := newTestResolver(t, policySources(enricher),
+		WithSourcePolicy[int]("enricher", SourcePolicy{BatchSize: 1}))
+
+	entities, _, err := e.ProcessQuery(context.Background(), exists("f"), ResultSchema{"a"})
+	if err != nil {
+		t.Fatalf("ProcessQuery() error = %v", err)
+	}
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1 2]", ids)
+	}
+
+	enricher.mu.Lock()
+	defer enricher.mu.Unlock()
+	for _, call := range enricher.calls {
+		if len(call) != 1 {
+			t.Errorf("a batch had %d entities, want 1", len(call))
+		}
+	}
+	if len(enricher.calls) != 2 {
+		t.Errorf("source was called %d times, want 2", len(enricher.calls))
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"github.com/ZarthaxX/query-resolver/operator"
+	"golang.org/x/exp/slices"
+)
+
+/*
+DataSourceCapabilities can be implemented by a DataSource to declare which operators it can filter by on each field.
+Such a source only receives the part of the query it can push down, and the engine evaluates the rest.
+Sources that don't implement it receive the whole query.
+*/
+type DataSourceCapabilities interface {
+	GetSupportedOperators() map[FieldName][]operator.ComparisonType
+}
+
+// pushdownQuery returns the terms of the query the producer is able to filter by
+func pushdownQuery[T comparable](source DataSource[T], query *operator.And) *operator.And {
+	capable, ok := source.(DataSourceCapabilities)
+	if !ok {
+		return query
+	}
+
+	supported := capable.GetSupportedOperators()
+	terms := []operator.Comparison{}
+	for _, term := range query.Terms {
+		if supportsTerm(supported, term) {
+			terms = append(terms, term)
+		}
+	}
+
+	return operator.NewAnd(terms...)
+}
+
+// supportsTerm tells if every comparison in the term is supported on all of its fields
+func supportsTerm(supported map[FieldName][]operator.ComparisonType, term operator.Comparison) bool {
+	predicates := operator.GetPredicates(term)
+	if len(predicates) == 0 {
+		return false
+	}
+
+	for _, p := range predicates {
+		if len(p.Fields) == 0 {
+			return false
+		}
+
+		for _, f := range p.Fields {
+			if !slices.Contains(supported[f], p.Type) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
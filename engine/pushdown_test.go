@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestPushdownQuery(t *testing.T) {
+	less := operator.NewLess(operator.NewField("a"), operator.NewConst(value.NewInt64(5)))
+	capable := capableSource{
+		testSource: &testSource{name: "capable", fields: []FieldName{"a", "b"}},
+		operators: map[FieldName][]operator.ComparisonType{
+			"a": {operator.EqualType},
+			"b": {operator.ExistsType},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		source DataSource[int]
+		query  *operator.And
+		want   *operator.And
+	}{
+		{
+			name:   "without capabilities",
+			source: &testSource{name: "plain", fields: []FieldName{"a"}},
+			query:  operator.NewAnd(equal("a", value.NewInt64(1)), less),
+			want:   operator.NewAnd(equal("a", value.NewInt64(1)), less),
+		},
+		{
+			name:   "unsupported operator",
+			source: capable,
+			query:  operator.NewAnd(equal("a", value.NewInt64(1)), less),
+			want:   operator.NewAnd(equal("a", value.NewInt64(1))),
+		},
+		{
+			name:   "unsupported field",
+			source: capable,
+			query:  operator.NewAnd(operator.NewExists("b"), equal("c", value.NewInt64(1))),
+			want:   operator.NewAnd(operator.NewExists("b")),
+		},
+		{
+			name:   "compound term fully supported",
+			source: capable,
+			query:  operator.NewAnd(operator.NewOr(equal("a", value.NewInt64(1)), operator.NewExists("b"))),
+			want:   operator.NewAnd(operator.NewOr(equal("a", value.NewInt64(1)), operator.NewExists("b"))),
+		},
+		{
+			name:   "compound term partially supported",
+			source: capable,
+			query:  operator.NewAnd(operator.NewOr(equal("a", value.NewInt64(1)), less)),
+			want:   operator.NewAnd(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pushdownQuery(tt.source, tt.query); got.String() != tt.want.String() {
+				t.Errorf("pushdownQuery() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesReceiveOnlyTheTermsTheySupport(t *testing.T) {
+	producer := capableSource{
+		testSource: &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+			1: {"a": value.NewInt64(1)},
+			2: {"a": value.NewInt64(2)},
+		}},
+		operators: map[FieldName][]operator.ComparisonType{"a": {operator.EqualType}},
+	}
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"b"}, rows: map[int]row{
+		1: {"b": value.NewInt64(10)},
+		2: {"b": value.NewInt64(20)},
+	}}
+	e := newTestResolver(t, []DataSource[int]{producer, enricher})
+
+	query := operator.NewAnd(equal("a", value.NewInt64(1)), equal("b", value.NewInt64(10)))
+	entities, solved, err := e.ProcessQuery(context.Background(), query, ResultSchema{"a"})
+	if err != nil || !solved {
+		t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+	}
+	// the producer ignores its filter, so the engine evaluates it anyway
+	if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+		t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+	}
+
+	if want := operator.NewAnd(equal("a", value.NewInt64(1))).String(); producer.queries[0].String() != want {
+		t.Errorf("producer query = %s, want %s", producer.queries[0], want)
+	}
+	if want := operator.NewAnd().String(); enricher.queries[0].String() != want {
+		t.Errorf("enricher query = %s, want %s", enricher.queries[0], want)
+	}
+}
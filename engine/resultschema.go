@@ -1,5 +1,65 @@
 package engine
 
-import "github.com/ZarthaxX/query-resolver/value"
+import (
+	"context"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+)
 
 type ResultSchema = []value.FieldName
+
+type optionalFieldsKey struct{}
+
+/*
+WithOptionalFields marks fields of the result schema as optional for the queries processed with the returned context.
+They are retrieved like any other, but entities without a value for them are kept in the result.
+*/
+func WithOptionalFields(ctx context.Context, fields ...FieldName) context.Context {
+	optional := map[FieldName]struct{}{}
+	for f := range optionalFields(ctx) {
+		optional[f] = struct{}{}
+	}
+	for _, f := range fields {
+		optional[f] = struct{}{}
+	}
+
+	return context.WithValue(ctx, optionalFieldsKey{}, optional)
+}
+
+// optionalFields returns the fields of the result schema the context marks as optional
+func optionalFields(ctx context.Context) map[FieldName]struct{} {
+	optional, _ := ctx.Value(optionalFieldsKey{}).(map[FieldName]struct{})
+	return optional
+}
+
+// resultSchemaQuery is the query used to retrieve the fields of the result schema.
+// Optional fields must be retrieved too, but either their presence or their absence satisfies it.
+func resultSchemaQuery(resultSchema ResultSchema, optional map[FieldName]struct{}) *operator.And {
+	terms := []operator.Comparison{}
+	for _, f := range resultSchema {
+		if _, ok := optional[f]; ok {
+			terms = append(terms, optionalFieldTerm(f))
+		} else {
+			terms = append(terms, operator.NewExists(f))
+		}
+	}
+
+	return operator.NewAnd(terms...)
+}
+
+// optionalFieldsQuery is the query used to retrieve fields that entities may lack,
+// so the ones without them are not discarded while retrieving the rest
+func optionalFieldsQuery(fields []FieldName) *operator.And {
+	terms := []operator.Comparison{}
+	for _, f := range fields {
+		terms = append(terms, optionalFieldTerm(f))
+	}
+
+	return operator.NewAnd(terms...)
+}
+
+// optionalFieldTerm holds once the field was retrieved, whether the entity has a value for it or not
+func optionalFieldTerm(f FieldName) operator.Comparison {
+	return operator.NewOr(operator.NewExists(f), operator.NewNotExists(f))
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"golang.org/x/exp/slices"
+)
+
+func TestOptionalResultSchemaFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		optional []FieldName
+		want     []int
+	}{
+		{name: "required", want: []int{0, 2}},
+		{name: "optional", optional: []FieldName{"s"}, want: []int{0, 1, 2, 3}},
+		{name: "other field optional", optional: []FieldName{"z"}, want: []int{0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestResolver(t, pageSources())
+			ctx := WithOptionalFields(context.Background(), tt.optional...)
+
+			entities, solved, err := e.ProcessQuery(ctx, exists("a"), ResultSchema{"a", "s"})
+			if err != nil || !solved {
+				t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+			}
+			if ids := sortedIDs(entities); !slices.Equal(ids, tt.want) {
+				t.Errorf("ProcessQuery() ids = %v, want %v", ids, tt.want)
+			}
+			for id, entity := range entities {
+				// the optional field was retrieved, so its absence is known
+				if entity.FieldExists("s") == logic.Undefined {
+					t.Errorf("entity %d field s was not retrieved", id)
+				}
+			}
+		})
+	}
+}
+
+func TestWithOptionalFieldsAddsToTheContext(t *testing.T) {
+	ctx := WithOptionalFields(context.Background(), "a")
+	ctx = WithOptionalFields(ctx, "b")
+
+	optional := optionalFields(ctx)
+	for _, f := range []FieldName{"a", "b"} {
+		if _, ok := optional[f]; !ok {
+			t.Errorf("field %s is not optional", f)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package engine
+
+type Role string
+
+const (
+	// ProducerRole sources create entities, receiving the part of the query they can push down
+	ProducerRole Role = "producer"
+	// EnricherRole sources only decorate entities that other sources produced
+	EnricherRole Role = "enricher"
+)
+
+/*
+DataSourceRole can be implemented by a DataSource to declare its Role.
+Enrichers are consulted after every producer, only receive the entities known so far and no filter,
+and any entity they return that is not known is ignored.
+Sources that don't implement it are producers.
+*/
+type DataSourceRole interface {
+	GetRole() Role
+}
+
+func sourceRole[T comparable](source DataSource[T]) Role {
+	if roled, ok := source.(DataSourceRole); ok {
+		return roled.GetRole()
+	}
+
+	return ProducerRole
+}
+
+// singleProducer returns the only producer among the sources, if there is exactly one
+func (e *ExpressionResolver[T]) singleProducer() (int, bool) {
+	producer := -1
+	for i, source := range e.sources {
+		if sourceRole(source) != ProducerRole {
+			continue
+		}
+		if producer >= 0 {
+			return 0, false
+		}
+		producer = i
+	}
+
+	return producer, producer >= 0
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestEnrichersOnlyDecorateKnownEntities(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources func(producer, enricher DataSource[int]) []DataSource[int]
+	}{
+		{name: "producer first", sources: func(producer, enricher DataSource[int]) []DataSource[int] {
+			return []DataSource[int]{producer, enricher}
+		}},
+		// enrichers wait for every producer, wherever they are registered
+		{name: "enricher first", sources: func(producer, enricher DataSource[int]) []DataSource[int] {
+			return []DataSource[int]{enricher, producer}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{
+				1: {"a": value.NewInt64(1)},
+				2: {"a": value.NewInt64(2)},
+			}}
+			// the enricher knows an entity no producer does, which must not show up
+			enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"b"}, rows: map[int]row{
+				1: {"b": value.NewInt64(10)},
+				3: {"b": value.NewInt64(30)},
+			}}
+			e := newTestResolver(t, tt.sources(producer, enricher))
+
+			entities, solved, err := e.ProcessQuery(context.Background(), exists("a"), ResultSchema{"a", "b"})
+			if err != nil || !solved {
+				t.Fatalf("ProcessQuery() = %v, %v", solved, err)
+			}
+			if ids := sortedIDs(entities); !slices.Equal(ids, []int{1}) {
+				t.Errorf("ProcessQuery() ids = %v, want [1]", ids)
+			}
+			for _, call := range enricher.calls {
+				if ids := sortedIDs(call); !slices.Equal(ids, []int{1, 2}) {
+					t.Errorf("enricher received %v, want [1 2]", ids)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		source DataSource[int]
+		want   Role
+	}{
+		{name: "producer", source: &testSource{role: ProducerRole}, want: ProducerRole},
+		{name: "enricher", source: &testSource{role: EnricherRole}, want: EnricherRole},
+		{name: "undeclared", source: decoratingSource{field: "a"}, want: ProducerRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceRole(tt.source); got != tt.want {
+				t.Errorf("sourceRole() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
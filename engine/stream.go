@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/transform"
+)
+
+/*
+EntityStream iterates over the entities matching a query as they are resolved.
+Next waits for the next entity, returning false once there are no more or the query failed, which Err tells.
+Clauses are resolved one at a time, and the result schema of their matches is built in batches,
+each one waiting for Next to take every entity of the previous one, so a slow caller holds back the query.
+Close stops the query for good.
+
+	stream := resolver.ProcessQueryStream(ctx, query, schema)
+	defer stream.Close()
+	for stream.Next() {
+		entity := stream.Entity()
+	}
+	if err := stream.Err(); err != nil {
+	}
+*/
+type EntityStream[T comparable] struct {
+	entities chan Entity[T]
+	done     chan struct{}
+	cancel   context.CancelFunc
+	current  Entity[T]
+	err      error
+}
+
+func (s *EntityStream[T]) Next() bool {
+	entity, ok := <-s.entities
+	if !ok {
+		return false
+	}
+
+	s.current = entity
+	return true
+}
+
+func (s *EntityStream[T]) Entity() Entity[T] {
+	return s.current
+}
+
+/*
+Err returns the error that ended the stream, once Next returned false.
+Like ProcessQuery, it is a QueryDegradedError when degrading gracefully left some entities undecided.
+*/
+func (s *EntityStream[T]) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+/*
+Close stops resolving the query and waits for it to finish
+*/
+func (s *EntityStream[T]) Close() error {
+	s.cancel()
+	for range s.entities {
+	}
+	<-s.done
+
+	// the stream was stopped on purpose, so its cancellation is not a failure
+	if errors.Is(s.err, context.Canceled) {
+		return nil
+	}
+	return s.err
+}
+
+const defaultStreamBatchSize = 100
+
+/*
+WithStreamBatchSize sets how many entities ProcessQueryStream builds the result schema of at a time,
+which bounds how far the query gets ahead of the caller.
+A size lower than 1 means the default of 100.
+*/
+func WithStreamBatchSize[T comparable](size int) Option[T] {
+	return func(e *ExpressionResolver[T]) {
+		e.streamBatchSize = size
+	}
+}
+
+/*
+ProcessQueryStream works like ProcessQuery, but emits every matching entity as soon as the clause matching it
+and its result schema are resolved, instead of gathering the whole result first.
+Entities matching more than one clause are emitted once.
+*/
+func (e *ExpressionResolver[T]) ProcessQueryStream(ctx context.Context, query QueryExpression, resultSchema ResultSchema) *EntityStream[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &EntityStream[T]{
+		entities: make(chan Entity[T]),
+		done:     make(chan struct{}),
+		cancel:   cancel,
+	}
+
+	go func() {
+		// done is closed first, so Err is ready as soon as Next returns false
+		defer close(s.entities)
+		defer close(s.done)
+		s.err = e.streamQuery(ctx, query, resultSchema, s.entities)
+	}()
+
+	return s
+}
+
+func (e *ExpressionResolver[T]) streamQuery(ctx context.Context, query QueryExpression, resultSchema ResultSchema, out chan<- Entity[T]) error {
+	f := e.newFetcher()
+	query = transform.ToDisjunctiveNormalForm(query)
+	clauses := query.(*operator.Or).Terms
+
+	batchSize := e.streamBatchSize
+	if batchSize < 1 {
+		batchSize = defaultStreamBatchSize
+	}
+
+	emitted := map[T]struct{}{}
+	undecided := map[T]struct{}{}
+	affected := map[T]struct{}{}
+	for _, clause := range clauses {
+		matched, undecidedEntities, err := e.resolveQuery(ctx, f, clause.(*operator.And), Entities[T]{}, false)
+		if err != nil {
+			return err
+		}
+
+		// entities already emitted by another clause are left out
+		for id := range undecidedEntities {
+			undecided[id] = struct{}{}
+		}
+		for id := range matched {
+			if _, ok := emitted[id]; ok {
+				delete(matched, id)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		// the next batch is only built once the caller took every entity of the previous one
+		for _, batch := range splitBatches(matched, batchSize) {
+			batch, incomplete, err := e.buildResultSchema(ctx, f, batch, resultSchema)
+			if err != nil {
+				return err
+			}
+			for id := range incomplete {
+				affected[id] = struct{}{}
+			}
+
+			for id, entity := range batch {
+				emitted[id] = struct{}{}
+				select {
+				case out <- entity:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+
+	for id := range undecided {
+		if _, ok := emitted[id]; !ok {
+			affected[id] = struct{}{}
+		}
+	}
+
+	_, _, err := e.degradedResult(f, nil, affected)
+	return err
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestProcessQueryStreamEmitsEveryEntityOnce(t *testing.T) {
+	e := newTestResolver(t, pageSources())
+	// entities 0 and 2 match both clauses
+	query := operator.NewOr(
+		operator.NewAnd(operator.NewExists("s")),
+		operator.NewAnd(operator.NewNot(equal("a", value.NewInt64(1)))),
+	)
+
+	stream := e.ProcessQueryStream(context.Background(), query, ResultSchema{"a"})
+	defer stream.Close()
+
+	ids := []int{}
+	for stream.Next() {
+		entity := stream.Entity()
+		if entity.FieldExists("a") != logic.True {
+			t.Errorf("entity %d was emitted without its result schema", entity.GetID())
+		}
+		ids = append(ids, entity.GetID())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	sort.Ints(ids)
+	if !slices.Equal(ids, []int{0, 2, 3}) {
+		t.Errorf("stream ids = %v, want [0 2 3]", ids)
+	}
+}
+
+func TestProcessQueryStreamClose(t *testing.T) {
+	e := newTestResolver(t, pageSources())
+	stream := e.ProcessQueryStream(context.Background(), exists("a"), ResultSchema{"a"})
+
+	if !stream.Next() {
+		t.Fatalf("Next() = false, Err() = %v", stream.Err())
+	}
+	// stopping the stream on purpose is not a failure
+	if err := stream.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil", err)
+	}
+	if stream.Next() {
+		t.Error("Next() = true after Close()")
+	}
+}
+
+func TestProcessQueryStreamReportsErrors(t *testing.T) {
+	failing := &testSource{name: "failing", fields: []FieldName{"a"}, err: errUnavailable}
+	e := newTestResolver(t, []DataSource[int]{failing})
+	stream := e.ProcessQueryStream(context.Background(), exists("a"), ResultSchema{"a"})
+	defer stream.Close()
+
+	if stream.Next() {
+		t.Error("Next() = true for a failing query")
+	}
+	if err := stream.Err(); !errors.Is(err, errUnavailable) {
+		t.Errorf("Err() = %v, want %v", err, errUnavailable)
+	}
+}
+
+func TestProcessQueryStreamWaitsForTheReader(t *testing.T) {
+	producer := &testSource{name: "producer", fields: []FieldName{"a"}, rows: map[int]row{}}
+	enricher := &testSource{name: "enricher", role: EnricherRole, fields: []FieldName{"b"}, rows: map[int]row{}}
+	for id := 0; id < 5; id++ {
+		producer.rows[id] = row{"a": value.NewInt64(int64(id))}
+		enricher.rows[id] = row{"b": value.NewInt64(int64(id))}
+	}
+	e := newTestResolver(t, []DataSource[int]{producer, enricher}, WithStreamBatchSize[int](2))
+
+	stream := e.ProcessQueryStream(context.Background(), exists("a"), ResultSchema{"a", "b"})
+	defer stream.Close()
+
+	if !stream.Next() {
+		t.Fatalf("Next() = false, Err() = %v", stream.Err())
+	}
+	// while the reader holds back, the stream is stuck emitting the first batch
+	time.Sleep(20 * time.Millisecond)
+	enricher.mu.Lock()
+	calls := len(enricher.calls)
+	enricher.mu.Unlock()
+	if calls != 1 {
+		t.Errorf("enricher was called %d times before the first batch was read, want 1", calls)
+	}
+
+	ids := []int{stream.Entity().GetID()}
+	for stream.Next() {
+		ids = append(ids, stream.Entity().GetID())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	sort.Ints(ids)
+	if !slices.Equal(ids, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("stream ids = %v, want [0 1 2 3 4]", ids)
+	}
+	for _, call := range enricher.calls {
+		if len(call) > 2 {
+			t.Errorf("enricher received %v, want batches of at most 2 entities", sortedIDs(call))
+		}
+	}
+}
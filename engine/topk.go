@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/transform"
+	"golang.org/x/exp/slices"
+)
+
+/*
+IncrementalDataSource can be implemented by a SortableDataSource to retrieve its entities sorted, a chunk at a time.
+RetrieveSortedFields returns up to limit entities after the cursor, in order, along with the cursor of the next chunk,
+which is empty once there are no more. An empty cursor asks for the first chunk.
+Retrieving the same cursor with the same limit must return the same chunk.
+
+When it is the only producer and can sort by every OrderBy field of a page with a Limit,
+ProcessQueryPage retrieves it a chunk at a time, and stops as soon as the page is full.
+The order of the page is then the order of the source.
+*/
+type IncrementalDataSource[T comparable] interface {
+	SortableDataSource
+	RetrieveSortedFields(ctx context.Context, query QueryExpression, orderBy []OrderBy, limit int, cursor string) ([]Entity[T], string, error)
+}
+
+// incrementalSource returns the source a page can be retrieved from a chunk at a time, if there is one
+func (e *ExpressionResolver[T]) incrementalSource(opts QueryOptions) (int, IncrementalDataSource[T], bool) {
+	if opts.Limit <= 0 || len(opts.OrderBy) == 0 {
+		return 0, nil, false
+	}
+
+	producer, ok := e.singleProducer()
+	if !ok {
+		return 0, nil, false
+	}
+
+	incremental, ok := e.sources[producer].(IncrementalDataSource[T])
+	if !ok {
+		return 0, nil, false
+	}
+	for _, o := range opts.OrderBy {
+		if !slices.Contains(incremental.GetSortableFields(), o.Field) {
+			return 0, nil, false
+		}
+	}
+
+	return producer, incremental, true
+}
+
+// processQueryTopK fills the page with the first matching entities of the source, a chunk at a time
+func (e *ExpressionResolver[T]) processQueryTopK(
+	ctx context.Context,
+	query QueryExpression,
+	resultSchema ResultSchema,
+	opts QueryOptions,
+	producer int,
+	source IncrementalDataSource[T],
+) (
+	Page[T],
+	bool,
+	error,
+) {
+	// matches before the offset are skipped, unless the cursor already points past them
+	position, skip := pageCursor{Mode: chunkCursor, Chunk: opts.Limit}, max(opts.Offset, 0)
+	if opts.Cursor != "" {
+		var err error
+		if position, err = decodeCursor(opts.Cursor, chunkCursor); err != nil {
+			return Page[T]{}, false, err
+		}
+		skip = 0
+	}
+
+	f := e.newFetcher()
+	query = transform.ToDisjunctiveNormalForm(query)
+	clauses := query.(*operator.Or).Terms
+	sourceQuery := incrementalQuery(e.sources[producer], clauses)
+
+	page := Page[T]{Entities: []Entity[T]{}}
+	affected := map[T]struct{}{}
+	for len(page.Entities) < opts.Limit {
+		chunk, next, err := source.RetrieveSortedFields(ctx, sourceQuery, opts.OrderBy, position.Chunk, position.Source)
+		if err != nil {
+			return Page[T]{}, false, err
+		}
+
+		entities, order := Entities[T]{}, []T{}
+		for _, entity := range chunk[min(position.Skip, len(chunk)):] {
+			entities[entity.id] = entity
+			order = append(order, entity.id)
+		}
+
+		matched, err := e.resolveChunk(ctx, f, clauses, producer, entities, resultSchema, affected)
+		if err != nil {
+			return Page[T]{}, false, err
+		}
+
+		for i, id := range order {
+			entity, ok := matched[id]
+			if !ok {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			page.Entities = append(page.Entities, entity)
+			if len(page.Entities) == opts.Limit {
+				// the rest of the chunk is left for the next page
+				if position.Skip+i+1 < len(chunk) {
+					page.NextCursor = encodeCursor(pageCursor{
+						Mode:   chunkCursor,
+						Source: position.Source,
+						Skip:   position.Skip + i + 1,
+						Chunk:  position.Chunk,
+					})
+				} else if next != "" {
+					page.NextCursor = encodeCursor(pageCursor{Mode: chunkCursor, Source: next, Chunk: position.Chunk})
+				}
+				break
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		if len(page.Entities) < opts.Limit {
+			position = pageCursor{Mode: chunkCursor, Source: next, Chunk: position.Chunk}
+		}
+	}
+
+	_, solved, err := e.degradedResult(f, nil, affected)
+	return page, solved, err
+}
+
+// resolveChunk returns the entities of the chunk matching any clause, with the fields of the schema
+func (e *ExpressionResolver[T]) resolveChunk(
+	ctx context.Context,
+	f *fetcher[T],
+	clauses []operator.Comparison,
+	producer int,
+	chunk Entities[T],
+	resultSchema ResultSchema,
+	affected map[T]struct{},
+) (
+	Entities[T],
+	error,
+) {
+	if len(chunk) == 0 {
+		return Entities[T]{}, nil
+	}
+
+	entities := Entities[T]{}
+	metadata := FieldMetadata{
+		Source:    sourceName(e.sources[producer]),
+		FetchedAt: time.Now(),
+		Round:     1,
+	}
+	if _, err := e.mergeEntities(map[FieldName]struct{}{}, entities, chunk, e.sources[producer], metadata); err != nil {
+		return nil, err
+	}
+
+	results := make([]Entities[T], len(clauses))
+	undecided := make([]Entities[T], len(clauses))
+	err := forEachClause(ctx, clauses, func(ctx context.Context, i int, clause *operator.And) (err error) {
+		// clauses decorate the entities concurrently, so each one gets its own copy
+		results[i], undecided[i], err = e.resolveQuery(ctx, f, clause, entities.clone(), true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := Entities[T]{}
+	for _, result := range results {
+		for id, entity := range result {
+			matched[id] = entity
+		}
+	}
+	for _, result := range undecided {
+		for id := range result {
+			if _, ok := matched[id]; !ok {
+				affected[id] = struct{}{}
+			}
+		}
+	}
+
+	matched, incomplete, err := e.buildResultSchema(ctx, f, matched, resultSchema)
+	if err != nil {
+		return nil, err
+	}
+	for id := range incomplete {
+		affected[id] = struct{}{}
+	}
+
+	return matched, nil
+}
+
+// incrementalQuery is the part of the query the source can filter by.
+// Clauses are only useful to it if every one of them can be pushed down.
+func incrementalQuery[T comparable](source DataSource[T], clauses []operator.Comparison) QueryExpression {
+	pushed := []operator.Comparison{}
+	for _, clause := range clauses {
+		and := pushdownQuery(source, clause.(*operator.And))
+		if len(and.Terms) == 0 {
+			return operator.NewAnd()
+		}
+		pushed = append(pushed, and)
+	}
+
+	return operator.NewOr(pushed...)
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+// incrementalSource is a producer of entities 0 to n-1, sorted by their field a, which is their ID
+type incrementalSource struct {
+	*testSource
+	n      int
+	chunks int
+}
+
+func newIncrementalSource(n int) *incrementalSource {
+	return &incrementalSource{testSource: &testSource{name: "producer", fields: []FieldName{"a"}}, n: n}
+}
+
+func (s *incrementalSource) GetSortableFields() []FieldName {
+	return []FieldName{"a"}
+}
+
+func (s *incrementalSource) RetrieveSortedFields(ctx context.Context, query QueryExpression, orderBy []OrderBy, limit int, cursor string) (
+	[]Entity[int],
+	string,
+	error,
+) {
+	s.chunks++
+
+	start := 0
+	if cursor != "" {
+		start, _ = strconv.Atoi(cursor)
+	}
+
+	chunk := []Entity[int]{}
+	for id := start; id < min(start+limit, s.n); id++ {
+		entity := NewEntity(id)
+		entity.AddField("a", value.NewInt64(int64(id)))
+		chunk = append(chunk, entity)
+	}
+
+	if start+limit >= s.n {
+		return chunk, "", nil
+	}
+	return chunk, strconv.Itoa(start + limit), nil
+}
+
+// oddSource tells which entities are odd, so the query can match only those
+func oddSource(n int) *testSource {
+	rows := map[int]row{}
+	for id := 1; id < n; id += 2 {
+		rows[id] = row{"odd": value.NewBool(true)}
+	}
+
+	return &testSource{name: "odd", role: EnricherRole, fields: []FieldName{"odd"}, rows: rows}
+}
+
+func TestProcessQueryPageRetrievesChunks(t *testing.T) {
+	producer := newIncrementalSource(10)
+	e := newTestResolver(t, []DataSource[int]{producer, oddSource(10)})
+	opts := QueryOptions{OrderBy: []OrderBy{{Field: "a"}}, Limit: 2}
+
+	first, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(first); !slices.Equal(ids, []int{1, 3}) {
+		t.Errorf("first page = %v, want [1 3]", ids)
+	}
+	// the page is full after the second chunk, so the rest of the source is never retrieved
+	if producer.chunks != 2 {
+		t.Errorf("retrieved %d chunks, want 2", producer.chunks)
+	}
+
+	opts.Cursor = first.NextCursor
+	second, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(second); !slices.Equal(ids, []int{5, 7}) {
+		t.Errorf("second page = %v, want [5 7]", ids)
+	}
+}
+
+func TestProcessQueryPageRetrievesChunksFromOffset(t *testing.T) {
+	e := newTestResolver(t, []DataSource[int]{newIncrementalSource(10), oddSource(10)})
+	opts := QueryOptions{OrderBy: []OrderBy{{Field: "a"}}, Limit: 2, Offset: 3}
+
+	page, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := pageIDs(page); !slices.Equal(ids, []int{7, 9}) || page.NextCursor != "" {
+		t.Errorf("page at offset 3 = %v, cursor %q, want [7 9] and no cursor", pageIDs(page), page.NextCursor)
+	}
+
+	// the cursor already accounts for the offset
+	opts.Offset, opts.Limit = 1, 1
+	first, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	opts.Cursor = first.NextCursor
+	second, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessQueryPage() error = %v", err)
+	}
+	if ids := append(pageIDs(first), pageIDs(second)...); !slices.Equal(ids, []int{3, 5}) {
+		t.Errorf("pages at offset 1 = %v, want [3 5]", ids)
+	}
+}
+
+func TestProcessQueryPageRejectsInvalidChunkCursors(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "from offsets", cursor: encodeCursor(pageCursor{Mode: offsetCursor, Offset: 2})},
+		{name: "without chunk size", cursor: encodeCursor(pageCursor{Mode: chunkCursor, Source: "2"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := newIncrementalSource(10)
+			e := newTestResolver(t, []DataSource[int]{producer, oddSource(10)})
+			opts := QueryOptions{OrderBy: []OrderBy{{Field: "a"}}, Limit: 2, Cursor: tt.cursor}
+
+			_, _, err := e.ProcessQueryPage(context.Background(), exists("odd"), ResultSchema{"a"}, opts)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("ProcessQueryPage() error = %v, want %v", err, ErrInvalidCursor)
+			}
+			if producer.chunks != 0 {
+				t.Errorf("retrieved %d chunks, want none", producer.chunks)
+			}
+		})
+	}
+}
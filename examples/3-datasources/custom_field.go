@@ -57,6 +57,15 @@ func NewOrderType(v string) OrderType {
 	return value.NewPrimitiveComparable(v)
 }
 
+type OrderDriverID = value.PrimitiveComparable[string]
+
+var OrderDriverIDName engine.FieldName = "order.driver_id"
+var OrderDriverIDField = operator.NewField(OrderDriverIDName)
+
+func NewOrderDriverID(v string) OrderDriverID {
+	return value.NewPrimitiveComparable(v)
+}
+
 type DriverName = value.PrimitiveComparable[string]
 
 var DriverNameName engine.FieldName = "driver.name"
@@ -80,8 +80,15 @@ func (v *OrderVisitor) GreaterEqual(e operator.GreaterEqual) {
 type OrderDataSource struct {
 }
 
+func (s OrderDataSource) GetSupportedOperators() map[engine.FieldName][]operator.ComparisonType {
+	return map[engine.FieldName][]operator.ComparisonType{
+		OrderStatusName:   {operator.EqualType, operator.InType},
+		ServiceAmountName: {operator.EqualType, operator.LessType},
+	}
+}
+
 func (s OrderDataSource) GetRetrievableFields() []engine.FieldName {
-	return []engine.FieldName{OrderStatusName, OrderTypeName, OrderRandomName}
+	return []engine.FieldName{OrderStatusName, OrderTypeName, OrderRandomName, OrderDriverIDName}
 }
 
 func (s OrderDataSource) RetrieveFields(ctx context.Context, query engine.QueryExpression, entities engine.Entities[OrderID]) (
@@ -94,6 +101,7 @@ func (s OrderDataSource) RetrieveFields(ctx context.Context, query engine.QueryE
 	e1 := engine.NewEntity(id1)
 	e1.AddField(OrderStatusName, NewOrderStatus("open"))
 	e1.AddField(OrderTypeName, NewOrderType("door"))
+	e1.AddField(OrderDriverIDName, NewOrderDriverID("driver_1"))
 	return engine.Entities[OrderID]{id1: e1},
 		true,
 		nil
@@ -102,6 +110,10 @@ func (s OrderDataSource) RetrieveFields(ctx context.Context, query engine.QueryE
 type ServiceDataSource struct {
 }
 
+func (s ServiceDataSource) GetRole() engine.Role {
+	return engine.EnricherRole
+}
+
 func (s ServiceDataSource) GetRetrievableFields() []engine.FieldName {
 	return []engine.FieldName{ServiceStartName, ServiceAmountName}
 }
@@ -121,10 +133,18 @@ func (s ServiceDataSource) RetrieveFields(ctx context.Context, query engine.Quer
 type DriverDataSource struct {
 }
 
+func (s *DriverDataSource) GetRole() engine.Role {
+	return engine.EnricherRole
+}
+
 func (s *DriverDataSource) GetRetrievableFields() []engine.FieldName {
 	return []engine.FieldName{DriverNameName}
 }
 
+func (s *DriverDataSource) GetRequiredFields() []engine.FieldName {
+	return []engine.FieldName{OrderDriverIDName}
+}
+
 func (s *DriverDataSource) RetrieveFields(ctx context.Context, query engine.QueryExpression, entities engine.Entities[OrderID]) (
 	result engine.Entities[OrderID],
 	applies bool,
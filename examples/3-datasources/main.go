@@ -35,9 +35,17 @@ func main() {
 		&DriverDataSource{},
 	}
 
-	resolver := engine.NewExpressionResolver(sources)
+	resolver, err := engine.NewExpressionResolver(sources)
+	if err != nil {
+		panic(err)
+	}
+
+	// fields the template has a default for, or only uses in expressions, don't discard the entities lacking them
+	ctx := engine.WithOptionalFields(context.TODO(), resultSchema.GetOptionalFields()...)
+
+	fmt.Println(resolver.Explain(query, resultSchema.GetResultSchema()))
 
-	entities, solved, err := resolver.ProcessQuery(context.TODO(), query, resultSchema.GetResultSchema())
+	entities, solved, err := resolver.ProcessQuery(ctx, query, resultSchema.GetResultSchema())
 	if err != nil {
 		panic(err)
 	}
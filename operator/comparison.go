@@ -230,12 +230,12 @@ func (o *In) Resolve(e Entity) (logic.TruthValue, error) {
 		return logic.Undefined, err
 	}
 
-	values, err := o.Terms.Resolve(e)
+	list, err := o.Terms.Resolve(e)
 	if err != nil {
 		return logic.Undefined, err
 	}
 
-	for _, v := range values {
+	for _, v := range list.Values() {
 		tv, err := v.Equal(va)
 		if err != nil {
 			return logic.Undefined, err
@@ -0,0 +1,83 @@
+package operator
+
+import (
+	"fmt"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+/*
+Conditional takes a condition and 2 values, and returns the first one when the condition is true
+and the second one when it is false. It is undefined when the condition is.
+*/
+type Conditional struct {
+	Condition  Comparison
+	Then, Else Value
+}
+
+func NewConditional(condition Comparison, then, otherwise Value) *Conditional {
+	return &Conditional{
+		Condition: condition,
+		Then:      then,
+		Else:      otherwise,
+	}
+}
+
+func (o *Conditional) Resolve(e Entity) (value.Value, error) {
+	if !o.IsResolvable(e) {
+		return nil, errUnresolvableExpression
+	}
+
+	tv, err := o.Condition.Resolve(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tv {
+	case logic.True:
+		return o.Then.Resolve(e)
+	case logic.False:
+		return o.Else.Resolve(e)
+	default:
+		return value.Undefined{}, nil
+	}
+}
+
+// IsResolvable only needs the value that the condition chooses to be resolvable
+func (o *Conditional) IsResolvable(e Entity) bool {
+	if !o.Condition.IsResolvable(e) {
+		return false
+	}
+
+	tv, err := o.Condition.Resolve(e)
+	if err != nil {
+		return false
+	}
+
+	switch tv {
+	case logic.True:
+		return o.Then.IsResolvable(e)
+	case logic.False:
+		return o.Else.IsResolvable(e)
+	default:
+		return true
+	}
+}
+
+func (o *Conditional) IsConst() bool {
+	return o.Condition.IsConst() && o.Then.IsConst() && o.Else.IsConst()
+}
+
+func (o *Conditional) IsField(_ value.FieldName) bool {
+	return false
+}
+
+func (o *Conditional) GetFieldNames() []value.FieldName {
+	fields := append(o.Condition.GetFieldNames(), o.Then.GetFieldNames()...)
+	return append(fields, o.Else.GetFieldNames()...)
+}
+
+func (o *Conditional) String() string {
+	return fmt.Sprintf("(%s ? %s : %s)", o.Condition.String(), o.Then.String(), o.Else.String())
+}
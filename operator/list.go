@@ -0,0 +1,578 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+/*
+ElementField is the field the predicate of a quantifier uses to refer to each element of the list, written as @$
+*/
+const ElementField value.FieldName = "$"
+
+/*
+ContainsAll takes 2 lists and returns if the first one contains every value of the second one.
+It is Undefined when the list is, or when some value can't be told to be in the list.
+*/
+type ContainsAll struct {
+	List, Terms ListValue
+}
+
+func NewContainsAll(list, terms ListValue) *ContainsAll {
+	return &ContainsAll{
+		List:  list,
+		Terms: terms,
+	}
+}
+
+func (o *ContainsAll) Resolve(e Entity) (logic.TruthValue, error) {
+	if !o.IsResolvable(e) {
+		return logic.Undefined, errUnresolvableExpression
+	}
+
+	list, terms, defined, err := resolveLists(e, o.List, o.Terms)
+	if err != nil || !defined {
+		return logic.Undefined, err
+	}
+
+	res := logic.True
+	for _, v := range terms.Values() {
+		tv, err := list.Contains(v)
+		if err != nil {
+			return logic.Undefined, err
+		}
+
+		res = res.And(tv)
+		if res == logic.False {
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+func (o *ContainsAll) IsResolvable(e Entity) bool {
+	return o.List.IsResolvable(e) && o.Terms.IsResolvable(e)
+}
+
+func (o *ContainsAll) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.ContainsAll(*o)
+	}
+}
+
+func (o *ContainsAll) IsConst() bool {
+	return o.List.IsConst() && o.Terms.IsConst()
+}
+
+func (o *ContainsAll) GetFieldNames() []value.FieldName {
+	return append(o.List.GetFieldNames(), o.Terms.GetFieldNames()...)
+}
+
+func (o *ContainsAll) Negate() Comparison {
+	return NewNotContainsAll(o.List, o.Terms)
+}
+
+func (o *ContainsAll) String() string {
+	return fmt.Sprintf("%s ⊇ %s", o.List.String(), o.Terms.String())
+}
+
+/*
+NotContainsAll takes 2 lists and returns if the first one lacks some value of the second one
+*/
+type NotContainsAll struct {
+	ContainsAll
+}
+
+func NewNotContainsAll(list, terms ListValue) *NotContainsAll {
+	return &NotContainsAll{
+		ContainsAll: *NewContainsAll(list, terms),
+	}
+}
+
+func (o *NotContainsAll) Resolve(e Entity) (logic.TruthValue, error) {
+	tv, err := o.ContainsAll.Resolve(e)
+	if err != nil {
+		return logic.Undefined, err
+	}
+
+	return tv.Not(), nil
+}
+
+func (o *NotContainsAll) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.NotContainsAll(*o)
+	}
+}
+
+func (o *NotContainsAll) Negate() Comparison {
+	return NewContainsAll(o.List, o.Terms)
+}
+
+func (o *NotContainsAll) String() string {
+	return strings.Replace(o.ContainsAll.String(), "⊇", "⊉", 1)
+}
+
+/*
+ContainsAny takes 2 lists and returns if the first one contains some value of the second one.
+It is Undefined when the list is, or when no value is in the list but some can't be told not to be.
+*/
+type ContainsAny struct {
+	List, Terms ListValue
+}
+
+func NewContainsAny(list, terms ListValue) *ContainsAny {
+	return &ContainsAny{
+		List:  list,
+		Terms: terms,
+	}
+}
+
+func (o *ContainsAny) Resolve(e Entity) (logic.TruthValue, error) {
+	if !o.IsResolvable(e) {
+		return logic.Undefined, errUnresolvableExpression
+	}
+
+	list, terms, defined, err := resolveLists(e, o.List, o.Terms)
+	if err != nil || !defined {
+		return logic.Undefined, err
+	}
+
+	return containsAny(list, terms)
+}
+
+func (o *ContainsAny) IsResolvable(e Entity) bool {
+	return o.List.IsResolvable(e) && o.Terms.IsResolvable(e)
+}
+
+func (o *ContainsAny) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.ContainsAny(*o)
+	}
+}
+
+func (o *ContainsAny) IsConst() bool {
+	return o.List.IsConst() && o.Terms.IsConst()
+}
+
+func (o *ContainsAny) GetFieldNames() []value.FieldName {
+	return append(o.List.GetFieldNames(), o.Terms.GetFieldNames()...)
+}
+
+func (o *ContainsAny) Negate() Comparison {
+	return NewNotContainsAny(o.List, o.Terms)
+}
+
+func (o *ContainsAny) String() string {
+	return fmt.Sprintf("%s ∋ any %s", o.List.String(), o.Terms.String())
+}
+
+/*
+NotContainsAny takes 2 lists and returns if the first one contains none of the values of the second one
+*/
+type NotContainsAny struct {
+	ContainsAny
+}
+
+func NewNotContainsAny(list, terms ListValue) *NotContainsAny {
+	return &NotContainsAny{
+		ContainsAny: *NewContainsAny(list, terms),
+	}
+}
+
+func (o *NotContainsAny) Resolve(e Entity) (logic.TruthValue, error) {
+	tv, err := o.ContainsAny.Resolve(e)
+	if err != nil {
+		return logic.Undefined, err
+	}
+
+	return tv.Not(), nil
+}
+
+func (o *NotContainsAny) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.NotContainsAny(*o)
+	}
+}
+
+func (o *NotContainsAny) Negate() Comparison {
+	return NewContainsAny(o.List, o.Terms)
+}
+
+func (o *NotContainsAny) String() string {
+	return strings.Replace(o.ContainsAny.String(), "∋", "∌", 1)
+}
+
+/*
+Intersects takes 2 lists and returns if they share some value, being Undefined when either list is.
+Unlike ContainsAny, neither list is meant to be the one searched, so both are usually fields.
+*/
+type Intersects struct {
+	TermA, TermB ListValue
+}
+
+func NewIntersects(a, b ListValue) *Intersects {
+	return &Intersects{
+		TermA: a,
+		TermB: b,
+	}
+}
+
+func (o *Intersects) Resolve(e Entity) (logic.TruthValue, error) {
+	if !o.IsResolvable(e) {
+		return logic.Undefined, errUnresolvableExpression
+	}
+
+	a, b, defined, err := resolveLists(e, o.TermA, o.TermB)
+	if err != nil || !defined {
+		return logic.Undefined, err
+	}
+
+	return containsAny(a, b)
+}
+
+func (o *Intersects) IsResolvable(e Entity) bool {
+	return o.TermA.IsResolvable(e) && o.TermB.IsResolvable(e)
+}
+
+func (o *Intersects) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.Intersects(*o)
+	}
+}
+
+func (o *Intersects) IsConst() bool {
+	return o.TermA.IsConst() && o.TermB.IsConst()
+}
+
+func (o *Intersects) GetFieldNames() []value.FieldName {
+	return append(o.TermA.GetFieldNames(), o.TermB.GetFieldNames()...)
+}
+
+func (o *Intersects) Negate() Comparison {
+	return NewNotIntersects(o.TermA, o.TermB)
+}
+
+func (o *Intersects) String() string {
+	return fmt.Sprintf("%s ∩ %s ≠ ∅", o.TermA.String(), o.TermB.String())
+}
+
+/*
+NotIntersects takes 2 lists and returns if they don't share any value
+*/
+type NotIntersects struct {
+	Intersects
+}
+
+func NewNotIntersects(a, b ListValue) *NotIntersects {
+	return &NotIntersects{
+		Intersects: *NewIntersects(a, b),
+	}
+}
+
+func (o *NotIntersects) Resolve(e Entity) (logic.TruthValue, error) {
+	tv, err := o.Intersects.Resolve(e)
+	if err != nil {
+		return logic.Undefined, err
+	}
+
+	return tv.Not(), nil
+}
+
+func (o *NotIntersects) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.NotIntersects(*o)
+	}
+}
+
+func (o *NotIntersects) Negate() Comparison {
+	return NewIntersects(o.TermA, o.TermB)
+}
+
+func (o *NotIntersects) String() string {
+	return fmt.Sprintf("%s ∩ %s = ∅", o.TermA.String(), o.TermB.String())
+}
+
+/*
+Any takes a list and a predicate, and returns if the predicate is true for some element of the list,
+which the predicate refers to as the ElementField.
+It is false for an empty list, and Undefined when the list is or when the predicate is Undefined for some element
+and false for the rest.
+*/
+type Any struct {
+	List      ListValue
+	Predicate Comparison
+}
+
+func NewAny(list ListValue, predicate Comparison) *Any {
+	return &Any{
+		List:      list,
+		Predicate: predicate,
+	}
+}
+
+func (o *Any) Resolve(e Entity) (logic.TruthValue, error) {
+	return resolveQuantifier(e, o.List, o.Predicate, logic.False)
+}
+
+func (o *Any) IsResolvable(e Entity) bool {
+	return isQuantifierResolvable(e, o.List, o.Predicate)
+}
+
+// Visit doesn't visit the predicate, as it is about the elements of the list rather than the entity
+func (o *Any) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.Any(*o)
+	}
+}
+
+func (o *Any) IsConst() bool {
+	return isQuantifierConst(o.List, o.Predicate)
+}
+
+func (o *Any) GetFieldNames() []value.FieldName {
+	return quantifierFieldNames(o.List, o.Predicate)
+}
+
+// Negate returns that the negated predicate is true for every element
+func (o *Any) Negate() Comparison {
+	return NewAll(o.List, o.Predicate.Negate())
+}
+
+func (o *Any) String() string {
+	return fmt.Sprintf("∃ $ ∈ %s: %s", o.List.String(), o.Predicate.String())
+}
+
+/*
+All takes a list and a predicate, and returns if the predicate is true for every element of the list,
+which the predicate refers to as the ElementField.
+It is true for an empty list, and Undefined when the list is or when the predicate is Undefined for some element
+and true for the rest.
+*/
+type All struct {
+	List      ListValue
+	Predicate Comparison
+}
+
+func NewAll(list ListValue, predicate Comparison) *All {
+	return &All{
+		List:      list,
+		Predicate: predicate,
+	}
+}
+
+func (o *All) Resolve(e Entity) (logic.TruthValue, error) {
+	return resolveQuantifier(e, o.List, o.Predicate, logic.True)
+}
+
+func (o *All) IsResolvable(e Entity) bool {
+	return isQuantifierResolvable(e, o.List, o.Predicate)
+}
+
+// Visit doesn't visit the predicate, as it is about the elements of the list rather than the entity
+func (o *All) Visit(visitor ExpressionVisitorIntarface) {
+	if visitor, ok := visitor.(ListExpressionVisitor); ok {
+		visitor.All(*o)
+	}
+}
+
+func (o *All) IsConst() bool {
+	return isQuantifierConst(o.List, o.Predicate)
+}
+
+func (o *All) GetFieldNames() []value.FieldName {
+	return quantifierFieldNames(o.List, o.Predicate)
+}
+
+// Negate returns that the negated predicate is true for some element
+func (o *All) Negate() Comparison {
+	return NewAny(o.List, o.Predicate.Negate())
+}
+
+func (o *All) String() string {
+	return fmt.Sprintf("∀ $ ∈ %s: %s", o.List.String(), o.Predicate.String())
+}
+
+/*
+Size takes a list and returns its length, being Undefined when the list is
+*/
+type Size struct {
+	List ListValue
+}
+
+func NewSize(list ListValue) *Size {
+	return &Size{List: list}
+}
+
+func (o *Size) Resolve(e Entity) (value.Value, error) {
+	if !o.IsResolvable(e) {
+		return nil, errUnresolvableExpression
+	}
+
+	list, defined, err := resolveList(e, o.List)
+	if err != nil {
+		return nil, err
+	}
+	if !defined {
+		return value.Undefined{}, nil
+	}
+
+	return value.NewInt64(int64(list.Len())), nil
+}
+
+func (o *Size) IsResolvable(e Entity) bool {
+	return o.List.IsResolvable(e)
+}
+
+func (o *Size) IsConst() bool {
+	return o.List.IsConst()
+}
+
+func (o *Size) IsField(_ value.FieldName) bool {
+	return false
+}
+
+func (o *Size) GetFieldNames() []value.FieldName {
+	return o.List.GetFieldNames()
+}
+
+func (o *Size) String() string {
+	return fmt.Sprintf("|%s|", o.List.String())
+}
+
+// elementEntity is the entity the predicate of a quantifier is resolved against for each element of the list
+type elementEntity struct {
+	Entity
+	element value.Value
+}
+
+func (e elementEntity) SeekField(f value.FieldName) (value.Value, error) {
+	if f == ElementField {
+		return e.element, nil
+	}
+
+	return e.Entity.SeekField(f)
+}
+
+func (e elementEntity) FieldExists(f value.FieldName) logic.TruthValue {
+	if f != ElementField {
+		return e.Entity.FieldExists(f)
+	}
+
+	_, ok := e.element.Value()
+	return logic.TruthValueFromBool(ok)
+}
+
+// resolveList resolves the list, telling an Undefined list field apart from an empty list
+func resolveList(e Entity, l ListValue) (value.List, bool, error) {
+	if f, ok := l.(*ListField); ok && e.FieldExists(f.FieldName) == logic.False {
+		return value.List{}, false, nil
+	}
+
+	list, err := l.Resolve(e)
+	return list, true, err
+}
+
+func resolveLists(e Entity, a, b ListValue) (value.List, value.List, bool, error) {
+	la, definedA, err := resolveList(e, a)
+	if err != nil {
+		return value.List{}, value.List{}, false, err
+	}
+
+	lb, definedB, err := resolveList(e, b)
+	if err != nil {
+		return value.List{}, value.List{}, false, err
+	}
+
+	return la, lb, definedA && definedB, nil
+}
+
+func containsAny(list, terms value.List) (logic.TruthValue, error) {
+	res := logic.False
+	for _, v := range terms.Values() {
+		tv, err := list.Contains(v)
+		if err != nil {
+			return logic.Undefined, err
+		}
+
+		res = res.Or(tv)
+		if res == logic.True {
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+// resolveQuantifier combines the predicate over every element, starting from the result for an empty list
+func resolveQuantifier(e Entity, l ListValue, predicate Comparison, empty logic.TruthValue) (logic.TruthValue, error) {
+	if !isQuantifierResolvable(e, l, predicate) {
+		return logic.Undefined, errUnresolvableExpression
+	}
+
+	list, defined, err := resolveList(e, l)
+	if err != nil || !defined {
+		return logic.Undefined, err
+	}
+
+	res := empty
+	for _, v := range list.Values() {
+		tv, err := predicate.Resolve(elementEntity{Entity: e, element: v})
+		if err != nil {
+			return logic.Undefined, err
+		}
+
+		if empty == logic.True {
+			res = res.And(tv)
+		} else {
+			res = res.Or(tv)
+		}
+		if res != empty && res != logic.Undefined {
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+// isQuantifierResolvable needs the predicate to be resolvable for every element of the list
+func isQuantifierResolvable(e Entity, l ListValue, predicate Comparison) bool {
+	if !l.IsResolvable(e) {
+		return false
+	}
+
+	list, defined, err := resolveList(e, l)
+	if err != nil {
+		return false
+	}
+	if !defined {
+		return true
+	}
+
+	for _, v := range list.Values() {
+		if !predicate.IsResolvable(elementEntity{Entity: e, element: v}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isQuantifierConst(l ListValue, predicate Comparison) bool {
+	return l.IsConst() && len(quantifierFieldNames(l, predicate)) == 0
+}
+
+// quantifierFieldNames returns the fields of the entity the quantifier uses, leaving out the elements of the list
+func quantifierFieldNames(l ListValue, predicate Comparison) []value.FieldName {
+	fields := l.GetFieldNames()
+	for _, f := range predicate.GetFieldNames() {
+		if f != ElementField {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,159 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func constStrings(values ...string) *ConstList {
+	list := []value.Value{}
+	for _, v := range values {
+		list = append(list, value.NewString(v))
+	}
+	return NewConstList(list)
+}
+
+func ints(values ...int64) value.List {
+	list := []value.Value{}
+	for _, v := range values {
+		list = append(list, value.NewInt64(v))
+	}
+	return value.NewList(list...)
+}
+
+func TestListComparisons(t *testing.T) {
+	entity := testEntity{
+		"tags":    value.NewList(value.NewString("a"), value.NewString("b"), value.NewString("c")),
+		"missing": value.Undefined{},
+	}
+	tags, missing := NewListField("tags"), NewListField("missing")
+
+	tests := []struct {
+		name       string
+		comparison Comparison
+		want       logic.TruthValue
+	}{
+		{"contains all", NewContainsAll(tags, constStrings("a", "c")), logic.True},
+		{"doesn't contain all", NewContainsAll(tags, constStrings("a", "d")), logic.False},
+		{"contains all of nothing", NewContainsAll(tags, constStrings()), logic.True},
+		{"not contains all", NewNotContainsAll(tags, constStrings("a", "d")), logic.True},
+		{"contains any", NewContainsAny(tags, constStrings("d", "c")), logic.True},
+		{"doesn't contain any", NewContainsAny(tags, constStrings("d")), logic.False},
+		{"not contains any", NewNotContainsAny(tags, constStrings("d")), logic.True},
+		{"intersects", NewIntersects(constStrings("d", "b"), tags), logic.True},
+		{"doesn't intersect", NewIntersects(tags, constStrings("d")), logic.False},
+		{"not intersects", NewNotIntersects(tags, constStrings("d")), logic.True},
+		{"undefined list", NewContainsAll(missing, constStrings("a")), logic.Undefined},
+		{"negated undefined list", NewNotContainsAny(missing, constStrings("a")), logic.Undefined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.comparison.IsResolvable(entity) {
+				t.Fatal("IsResolvable() = false")
+			}
+			tv, err := tt.comparison.Resolve(entity)
+			if err != nil || tv != tt.want {
+				t.Errorf("Resolve() = %v, %v, want %v", tv, err, tt.want)
+			}
+
+			// negating a comparison negates its result
+			tv, err = tt.comparison.Negate().Resolve(entity)
+			if err != nil || tv != tt.want.Not() {
+				t.Errorf("Negate().Resolve() = %v, %v, want %v", tv, err, tt.want.Not())
+			}
+		})
+	}
+
+	if NewContainsAll(NewListField("unknown"), constStrings("a")).IsResolvable(entity) {
+		t.Error("IsResolvable() = true for a field that wasn't retrieved")
+	}
+}
+
+func TestQuantifiers(t *testing.T) {
+	entity := testEntity{
+		"amounts": ints(1, 5, 10),
+		"empty":   ints(),
+		"limit":   value.NewInt64(8),
+	}
+	amounts := NewListField("amounts")
+	underLimit := NewLess(NewField(ElementField), NewField("limit"))
+
+	tests := []struct {
+		name       string
+		comparison Comparison
+		want       logic.TruthValue
+	}{
+		{"any", NewAny(amounts, underLimit), logic.True},
+		{"all", NewAll(amounts, underLimit), logic.False},
+		{"any of empty", NewAny(NewListField("empty"), underLimit), logic.False},
+		{"all of empty", NewAll(NewListField("empty"), underLimit), logic.True},
+		{"negated any", NewAny(amounts, underLimit).Negate(), logic.False},
+		{"negated all", NewAll(amounts, underLimit).Negate(), logic.True},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv, err := tt.comparison.Resolve(entity)
+			if err != nil || tv != tt.want {
+				t.Errorf("Resolve() = %v, %v, want %v", tv, err, tt.want)
+			}
+		})
+	}
+
+	// the elements of the list are not fields of the entity
+	if fields := NewAll(amounts, underLimit).GetFieldNames(); !slices.Equal(fields, []value.FieldName{"amounts", "limit"}) {
+		t.Errorf("GetFieldNames() = %v, want [amounts limit]", fields)
+	}
+}
+
+func TestSize(t *testing.T) {
+	entity := testEntity{"amounts": ints(1, 5, 10), "missing": value.Undefined{}}
+
+	if v, err := NewSize(NewListField("amounts")).Resolve(entity); err != nil || v.MustValue() != int64(3) {
+		t.Errorf("Resolve() = %v, %v, want 3", v, err)
+	}
+	if v, err := NewSize(NewListField("missing")).Resolve(entity); err != nil || v != (value.Undefined{}) {
+		t.Errorf("Resolve() = %v, %v, want Undefined", v, err)
+	}
+}
+
+// basicVisitor only knows the operators every visitor must handle
+type basicVisitor struct {
+	equals int
+}
+
+func (v *basicVisitor) Exists(Exists)             {}
+func (v *basicVisitor) NotExists(NotExists)       {}
+func (v *basicVisitor) Equal(Equal)               { v.equals++ }
+func (v *basicVisitor) NotEqual(NotEqual)         {}
+func (v *basicVisitor) Less(Less)                 {}
+func (v *basicVisitor) GreaterEqual(GreaterEqual) {}
+func (v *basicVisitor) In(In)                     {}
+func (v *basicVisitor) NotIn(NotIn)               {}
+
+func TestVisitorsWithoutListOperators(t *testing.T) {
+	query := NewAnd(
+		NewEqual(NewField("a"), NewConst(value.NewInt64(1))),
+		NewContainsAll(NewListField("tags"), constStrings("a")),
+		NewAny(NewListField("amounts"), NewLess(NewField(ElementField), NewConst(value.NewInt64(1)))),
+	)
+
+	visitor := basicVisitor{}
+	query.Visit(&visitor)
+	if visitor.equals != 1 {
+		t.Errorf("visited %d equals, want 1", visitor.equals)
+	}
+
+	want := []ComparisonType{EqualType, ContainsAllType, AnyType}
+	got := []ComparisonType{}
+	for _, p := range GetPredicates(query) {
+		got = append(got, p.Type)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("GetPredicates() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package operator
+
+import "github.com/ZarthaxX/query-resolver/value"
+
+type ComparisonType string
+
+var (
+	ExistsType         ComparisonType = "exists"
+	NotExistsType      ComparisonType = "not_exists"
+	EqualType          ComparisonType = "equal"
+	NotEqualType       ComparisonType = "not_equal"
+	LessType           ComparisonType = "less"
+	GreaterEqualType   ComparisonType = "greater_equal"
+	InType             ComparisonType = "in"
+	NotInType          ComparisonType = "not_in"
+	ContainsAllType    ComparisonType = "contains_all"
+	NotContainsAllType ComparisonType = "not_contains_all"
+	ContainsAnyType    ComparisonType = "contains_any"
+	NotContainsAnyType ComparisonType = "not_contains_any"
+	IntersectsType     ComparisonType = "intersects"
+	NotIntersectsType  ComparisonType = "not_intersects"
+	AnyType            ComparisonType = "any"
+	AllType            ComparisonType = "all"
+)
+
+/*
+Predicate is a single comparison found in an expression, along with the fields it uses
+*/
+type Predicate struct {
+	Type   ComparisonType
+	Fields []value.FieldName
+}
+
+/*
+GetPredicates returns every comparison found in the expression, in the order they are visited
+*/
+func GetPredicates(c Comparison) []Predicate {
+	visitor := predicateVisitor{}
+	c.Visit(&visitor)
+	return visitor.predicates
+}
+
+type predicateVisitor struct {
+	predicates []Predicate
+}
+
+func (v *predicateVisitor) add(t ComparisonType, fields []value.FieldName) {
+	v.predicates = append(v.predicates, Predicate{Type: t, Fields: fields})
+}
+
+func (v *predicateVisitor) Exists(e Exists) {
+	v.add(ExistsType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotExists(e NotExists) {
+	v.add(NotExistsType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) Equal(e Equal) {
+	v.add(EqualType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotEqual(e NotEqual) {
+	v.add(NotEqualType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) Less(e Less) {
+	v.add(LessType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) GreaterEqual(e GreaterEqual) {
+	v.add(GreaterEqualType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) In(e In) {
+	v.add(InType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotIn(e NotIn) {
+	v.add(NotInType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) ContainsAll(e ContainsAll) {
+	v.add(ContainsAllType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotContainsAll(e NotContainsAll) {
+	v.add(NotContainsAllType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) ContainsAny(e ContainsAny) {
+	v.add(ContainsAnyType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotContainsAny(e NotContainsAny) {
+	v.add(NotContainsAnyType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) Intersects(e Intersects) {
+	v.add(IntersectsType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) NotIntersects(e NotIntersects) {
+	v.add(NotIntersectsType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) Any(e Any) {
+	v.add(AnyType, e.GetFieldNames())
+}
+
+func (v *predicateVisitor) All(e All) {
+	v.add(AllType, e.GetFieldNames())
+}
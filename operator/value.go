@@ -19,7 +19,7 @@ type Value interface {
 }
 
 type ListValue interface {
-	Resolve(e Entity) ([]value.Value, error)
+	Resolve(e Entity) (value.List, error)
 	IsResolvable(e Entity) bool // call this before Resolve to check if value can be resolvable and avoid errors
 	GetFieldNames() []value.FieldName
 	IsConst() bool
@@ -75,27 +75,30 @@ func NewListField(fieldName value.FieldName) *ListField {
 	}
 }
 
-func (o ListField) Resolve(e Entity) (res []value.Value, err error) {
+// Resolve returns an empty list when the field is Undefined, and accepts lists stored as a PrimitiveBasic[[]value.Value]
+func (o ListField) Resolve(e Entity) (res value.List, err error) {
 	if !o.IsResolvable(e) {
-		return nil, errUnresolvableExpression
+		return value.List{}, errUnresolvableExpression
 	}
 
 	v, err := e.SeekField(o.FieldName)
 	if err != nil {
-		return nil, err
+		return value.List{}, err
 	}
 
-	rawValue, exists := v.Value()
-	if !exists {
-		return nil, nil
+	if _, exists := v.Value(); !exists {
+		return value.NewList(), nil
 	}
 
-	list, ok := rawValue.([]value.Value)
-	if !ok {
-		return nil, errors.New("value is not a list")
+	switch list := v.(type) {
+	case value.List:
+		return list, nil
+	case value.PrimitiveBasic[[]value.Value]:
+		// lists used to be stored as plain slices of values, which sources may still return
+		return value.NewList(list.MustValue().([]value.Value)...), nil
+	default:
+		return value.List{}, errors.New("value is not a list")
 	}
-
-	return list, nil
 }
 
 type Const struct {
@@ -132,14 +135,14 @@ func (o *Const) String() string {
 }
 
 type ConstList struct {
-	values []value.Value
+	values value.List
 }
 
 func NewConstList(v []value.Value) *ConstList {
-	return &ConstList{values: v}
+	return &ConstList{values: value.NewList(v...)}
 }
 
-func (o ConstList) Resolve(e Entity) ([]value.Value, error) {
+func (o ConstList) Resolve(e Entity) (value.List, error) {
 	return o.values, nil
 }
 
@@ -161,7 +164,7 @@ func (o *ConstList) IsField(_ value.FieldName) bool {
 
 func (o *ConstList) String() string {
 	values := []string{}
-	for _, v := range o.values {
+	for _, v := range o.values.Values() {
 		values = append(values, fmt.Sprintf("%+v", v.MustValue()))
 	}
 
@@ -0,0 +1,72 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+// testEntity is an Entity over a map, where missing fields are Undefined like in the engine
+type testEntity map[value.FieldName]value.Value
+
+func (e testEntity) SeekField(f value.FieldName) (value.Value, error) {
+	v, ok := e[f]
+	if !ok {
+		return value.Undefined{}, nil
+	}
+	return v, nil
+}
+
+func (e testEntity) FieldExists(f value.FieldName) logic.TruthValue {
+	v, ok := e[f]
+	if !ok {
+		return logic.Undefined
+	}
+	if _, ok := v.(value.Undefined); ok {
+		return logic.False
+	}
+	return logic.True
+}
+
+func (e testEntity) AddField(name value.FieldName, v value.Value) {
+	e[name] = v
+}
+
+func TestListFieldResolve(t *testing.T) {
+	entity := testEntity{
+		"list":   value.NewList(value.NewInt64(1), value.NewInt64(2)),
+		"legacy": value.NewPrimitiveBasic([]value.Value{value.NewInt64(1), value.NewInt64(2)}),
+		"empty":  value.Undefined{},
+		"scalar": value.NewInt64(1),
+	}
+
+	for _, fn := range []value.FieldName{"list", "legacy"} {
+		list, err := NewListField(fn).Resolve(entity)
+		if err != nil {
+			t.Fatalf("Resolve(%s) error = %v", fn, err)
+		}
+		if list.Len() != 2 || list.Values()[1].MustValue() != int64(2) {
+			t.Errorf("Resolve(%s) = %v, want [1 2]", fn, list.MustValue())
+		}
+	}
+
+	if list, err := NewListField("empty").Resolve(entity); err != nil || list.Len() != 0 {
+		t.Errorf("Resolve(empty) = %v, %v, want an empty list", list.MustValue(), err)
+	}
+	if _, err := NewListField("scalar").Resolve(entity); err == nil {
+		t.Error("Resolve(scalar) resolved a value that is not a list")
+	}
+}
+
+func TestInLegacyList(t *testing.T) {
+	entity := testEntity{
+		"a":    value.NewInt64(2),
+		"list": value.NewPrimitiveBasic([]value.Value{value.NewInt64(1), value.NewInt64(2)}),
+	}
+
+	tv, err := NewIn(NewField("a"), NewListField("list")).Resolve(entity)
+	if err != nil || tv != logic.True {
+		t.Errorf("Resolve() = %v, %v, want true", tv, err)
+	}
+}
@@ -10,3 +10,18 @@ type ExpressionVisitorIntarface interface {
 	In(In)
 	NotIn(NotIn)
 }
+
+/*
+ListExpressionVisitor can be implemented by an ExpressionVisitorIntarface to visit the list operators too.
+Visitors that don't implement it skip them.
+*/
+type ListExpressionVisitor interface {
+	ContainsAll(ContainsAll)
+	NotContainsAll(NotContainsAll)
+	ContainsAny(ContainsAny)
+	NotContainsAny(NotContainsAny)
+	Intersects(Intersects)
+	NotIntersects(NotIntersects)
+	Any(Any)
+	All(All)
+}
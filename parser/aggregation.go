@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ZarthaxX/query-resolver/engine"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+type aggregationSpec struct {
+	GroupBy    []value.FieldName                     `json:"group_by"`
+	Aggregates map[string]map[string]value.FieldName `json:"aggregates"`
+}
+
+/*
+AggregationFromJSON parses an aggregation spec like
+
+	{"group_by": ["order.type"], "aggregates": {"orders": {"count": "*"}, "avg_amount": {"avg": "service.amount"}}}
+
+where each aggregate maps a function to the field it is computed over, "*" meaning the entities themselves.
+Aggregates are sorted by name.
+*/
+func AggregationFromJSON(data []byte) (engine.AggregationSpec, error) {
+	var raw aggregationSpec
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return engine.AggregationSpec{}, err
+	}
+
+	spec := engine.AggregationSpec{GroupBy: raw.GroupBy}
+	for name, aggregate := range raw.Aggregates {
+		if len(aggregate) != 1 {
+			return engine.AggregationSpec{}, fmt.Errorf("aggregate %s must have a single function", name)
+		}
+
+		for _, f := range raw.GroupBy {
+			if f == name {
+				return engine.AggregationSpec{}, fmt.Errorf("aggregate %s is named after a group by field", name)
+			}
+		}
+
+		for function, field := range aggregate {
+			if field == "*" {
+				field = ""
+			}
+
+			spec.Aggregates = append(spec.Aggregates, engine.Aggregate{
+				Name:     name,
+				Function: engine.AggregateFunction(function),
+				Field:    field,
+			})
+		}
+	}
+	sort.Slice(spec.Aggregates, func(i, j int) bool {
+		return spec.Aggregates[i].Name < spec.Aggregates[j].Name
+	})
+
+	return spec, nil
+}
+
+/*
+GroupsToJSON renders every group as an object with the values of its group by fields and its aggregates.
+Undefined values are rendered as null.
+*/
+func GroupsToJSON(groups []engine.Group) ([]byte, error) {
+	groupsMap := []map[string]any{}
+	for _, g := range groups {
+		groupMap := map[string]any{}
+		for f, v := range g.Keys {
+			groupMap[f], _ = v.Value()
+		}
+		for name, v := range g.Values {
+			groupMap[name], _ = v.Value()
+		}
+
+		groupsMap = append(groupsMap, groupMap)
+	}
+
+	return json.MarshalIndent(groupsMap, "", "	")
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/engine"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+/*
+EntityFromJSON decodes an object rendered by the template back into an entity, setting the fields the template renders
+and its ID if the template renders it.
+Keys missing from the object leave their field unset, while null values are decoded as Undefined.
+Metadata and expression entries can't be decoded and are skipped, and so are defaults,
+which are decoded as the value of the field they were rendered for.
+*/
+func EntityFromJSON[T comparable](t *Template, data []byte) (*engine.Entity[T], error) {
+	fields := map[value.FieldName]value.Value{}
+	rawID, err := t.decodeEntity(fields, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var id T
+	if rawID != nil {
+		if err := json.Unmarshal(rawID, &id); err != nil {
+			return nil, fmt.Errorf("entity id: %w", err)
+		}
+	}
+
+	entity := engine.NewEntity(id)
+	for f, v := range fields {
+		entity.AddField(f, v)
+	}
+
+	return &entity, nil
+}
+
+/*
+EntitiesFromJSON decodes an array rendered by the template with EntitiesToJSON
+*/
+func EntitiesFromJSON[T comparable](t *Template, data []byte) ([]*engine.Entity[T], error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	entities := []*engine.Entity[T]{}
+	for _, r := range raw {
+		entity, err := EntityFromJSON[T](t, r)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
+
+// decodeEntity sets the fields decoded from the object, and returns the raw ID if the object has it
+func (t *Template) decodeEntity(fields map[value.FieldName]value.Value, data []byte) (id json.RawMessage, err error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	for _, k := range t.keys {
+		raw, ok := object[k]
+		if !ok {
+			continue
+		}
+
+		if c, ok := t.childs[k]; ok {
+			childID, err := c.decodeEntity(fields, raw)
+			if err != nil {
+				return nil, err
+			}
+			if childID != nil {
+				id = childID
+			}
+			continue
+		}
+
+		f := t.fields[k]
+		if f.id {
+			id = raw
+			continue
+		}
+		if f.meta != "" || f.expression != nil {
+			continue
+		}
+
+		v, err := f.decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", k, err)
+		}
+		fields[f.name] = v
+	}
+
+	return id, nil
+}
+
+// decode parses a rendered value back, undoing its time layout
+func (f *templateField) decode(raw json.RawMessage) (value.Value, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return f.decodeValue(v)
+}
+
+func (f *templateField) decodeValue(v any) (value.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return value.Undefined{}, nil
+	case bool:
+		return value.NewBool(t), nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return value.NewInt64(i), nil
+		}
+
+		n, err := t.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return value.NewFloat64(n), nil
+	case string:
+		if f.timeLayout == "" {
+			return value.NewString(t), nil
+		}
+
+		tv, err := time.Parse(f.timeLayout, t)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewInt64(tv.Unix()), nil
+	case []any:
+		values := []value.Value{}
+		for _, lv := range t {
+			dv, err := f.decodeValue(lv)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, dv)
+		}
+		return value.NewList(values...), nil
+	default:
+		return nil, fmt.Errorf("can't decode %T values", v)
+	}
+}
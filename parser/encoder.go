@@ -0,0 +1,270 @@
+package parser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+)
+
+/*
+Encoder writes the entities rendered by a template to a writer, one at a time.
+Close writes whatever the encoder still holds, and must be called once every entity was encoded.
+
+	enc := parser.NewCSVEncoder(&template, w)
+	for _, entity := range entities {
+		if err := enc.Encode(entity); err != nil {
+		}
+	}
+	if err := enc.Close(); err != nil {
+	}
+*/
+type Encoder interface {
+	Encode(entity operator.Entity) error
+	Close() error
+}
+
+/*
+NDJSONEncoder writes every entity as a JSON object in its own line, as soon as it is encoded
+*/
+type NDJSONEncoder struct {
+	template *Template
+	enc      *json.Encoder
+}
+
+func NewNDJSONEncoder(t *Template, w io.Writer) *NDJSONEncoder {
+	return &NDJSONEncoder{template: t, enc: json.NewEncoder(w)}
+}
+
+func (e *NDJSONEncoder) Encode(entity operator.Entity) error {
+	entityMap, err := e.template.entityToMap(entity)
+	if err != nil {
+		return err
+	}
+
+	return e.enc.Encode(entityMap)
+}
+
+func (e *NDJSONEncoder) Close() error {
+	return nil
+}
+
+/*
+CSVEncoder writes every entity as a row, with a column for each field of the template.
+Columns are named after the keys of the template, joining the keys of nested templates with a dot like "order.status",
+and the header is written before the first row.
+Missing fields are left empty, and lists are written as JSON arrays.
+*/
+type CSVEncoder struct {
+	template *Template
+	w        *csv.Writer
+	columns  []string
+	header   bool
+}
+
+func NewCSVEncoder(t *Template, w io.Writer) *CSVEncoder {
+	return &CSVEncoder{template: t, w: csv.NewWriter(w), columns: t.columns("")}
+}
+
+func (e *CSVEncoder) Encode(entity operator.Entity) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	row, err := e.template.entityToRow(entity)
+	if err != nil {
+		return err
+	}
+
+	record := []string{}
+	for _, c := range e.columns {
+		cell, err := csvCell(row[c])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", c, err)
+		}
+		record = append(record, cell)
+	}
+
+	return e.w.Write(record)
+}
+
+// Close writes the header even if there were no entities
+func (e *CSVEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *CSVEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+
+	e.header = true
+	return e.w.Write(e.columns)
+}
+
+func csvCell(v any) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+/*
+Column holds the values of a field of the template for every entity of a Batch, nil for the ones missing it.
+Type is the type of its values, like "int64" or "list", "mixed" when they have different types
+and "null" when every value is missing.
+*/
+type Column struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Values []any  `json:"values"`
+}
+
+/*
+Batch holds the entities rendered by a template by column
+*/
+type Batch struct {
+	Rows    int      `json:"rows"`
+	Columns []Column `json:"columns"`
+}
+
+/*
+ColumnarEncoder gathers the entities in a Batch with a column for each field of the template, named like CSVEncoder does.
+Close writes the batch as a JSON object, and Batch returns it to use it in memory instead.
+*/
+type ColumnarEncoder struct {
+	template *Template
+	w        io.Writer
+	batch    Batch
+}
+
+func NewColumnarEncoder(t *Template, w io.Writer) *ColumnarEncoder {
+	batch := Batch{Columns: []Column{}}
+	for _, c := range t.columns("") {
+		batch.Columns = append(batch.Columns, Column{Name: c, Values: []any{}})
+	}
+
+	return &ColumnarEncoder{template: t, w: w, batch: batch}
+}
+
+func (e *ColumnarEncoder) Encode(entity operator.Entity) error {
+	row, err := e.template.entityToRow(entity)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range e.batch.Columns {
+		e.batch.Columns[i].Values = append(c.Values, row[c.Name])
+	}
+	e.batch.Rows++
+
+	return nil
+}
+
+func (e *ColumnarEncoder) Batch() Batch {
+	for i, c := range e.batch.Columns {
+		e.batch.Columns[i].Type = columnType(c.Values)
+	}
+
+	return e.batch
+}
+
+func (e *ColumnarEncoder) Close() error {
+	return json.NewEncoder(e.w).Encode(e.Batch())
+}
+
+func columnType(values []any) string {
+	t := "null"
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+
+		vt := valueType(v)
+		if t != "null" && t != vt {
+			return "mixed"
+		}
+		t = vt
+	}
+
+	return t
+}
+
+func valueType(v any) string {
+	switch v.(type) {
+	case bool:
+		return "bool"
+	case int, int64:
+		return "int64"
+	case float64:
+		return "float64"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case []any:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+// columns returns the flattened names of the fields of the template, in the order they are written
+func (t *Template) columns(prefix string) []string {
+	columns := []string{}
+	for _, k := range t.keys {
+		if c, ok := t.childs[k]; ok {
+			columns = append(columns, c.columns(prefix+k+".")...)
+			continue
+		}
+		columns = append(columns, prefix+k)
+	}
+
+	return columns
+}
+
+// entityToRow renders the entity keyed by the flattened names of the fields
+func (t *Template) entityToRow(entity operator.Entity) (map[string]any, error) {
+	entityMap, err := t.entityToMap(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	row := map[string]any{}
+	flattenObject(entityMap, "", row)
+	return row, nil
+}
+
+func flattenObject(o *object, prefix string, row map[string]any) {
+	for _, k := range o.keys {
+		if child, ok := o.values[k].(*object); ok {
+			flattenObject(child, prefix+k+".", row)
+			continue
+		}
+		row[prefix+k] = o.values[k]
+	}
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/engine"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+// encoderEntities are rendered by encoderTemplate, the second one missing its service, type and points
+func encoderEntities() []operator.Entity {
+	complete := engine.NewEntity("1")
+	complete.AddField("order.status", value.NewString("done"))
+	complete.AddField("order.type", value.NewString("car"))
+	complete.AddField("order.points", value.NewInt64(5))
+	complete.AddField("service.amount", value.NewInt64(20))
+	complete.AddField("service.tags", value.NewList(value.NewString("a"), value.NewString("b")))
+
+	partial := engine.NewEntity("2")
+	partial.AddField("order.status", value.NewString(`late, "really"`))
+
+	return []operator.Entity{&complete, &partial}
+}
+
+func encoderTemplate(t *testing.T) *Template {
+	template, err := TemplateFromJSON([]byte(`{
+		"id": "$id",
+		"status": "order.status",
+		"service": {"amount": "service.amount", "tags": "service.tags"},
+		"type": {"$field": "order.type", "$default": "door"},
+		"points": {"$field": "order.points", "$default": 0}
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	return &template
+}
+
+func encode(t *testing.T, enc Encoder, entities []operator.Entity) {
+	for _, entity := range entities {
+		if err := enc.Encode(entity); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	var b bytes.Buffer
+	encode(t, NewNDJSONEncoder(encoderTemplate(t), &b), encoderEntities())
+
+	want := `{"id":"1","status":"done","service":{"amount":20,"tags":["a","b"]},"type":"car","points":5}` + "\n" +
+		`{"id":"2","status":"late, \"really\"","service":{},"type":"door","points":0}` + "\n"
+	if b.String() != want {
+		t.Errorf("NDJSON = %s, want %s", b.String(), want)
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		entities []operator.Entity
+		want     string
+	}{
+		{
+			name:     "entities",
+			entities: encoderEntities(),
+			want: "id,status,service.amount,service.tags,type,points\n" +
+				`1,done,20,"[""a"",""b""]",car,5` + "\n" +
+				`2,"late, ""really""",,,door,0` + "\n",
+		},
+		{name: "no entities", entities: nil, want: "id,status,service.amount,service.tags,type,points\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			encode(t, NewCSVEncoder(encoderTemplate(t), &b), tt.entities)
+
+			if b.String() != tt.want {
+				t.Errorf("CSV = %s, want %s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnarEncoder(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewColumnarEncoder(encoderTemplate(t), &b)
+	encode(t, enc, encoderEntities())
+
+	want := Batch{Rows: 2, Columns: []Column{
+		{Name: "id", Type: "string", Values: []any{"1", "2"}},
+		{Name: "status", Type: "string", Values: []any{"done", `late, "really"`}},
+		{Name: "service.amount", Type: "int64", Values: []any{int64(20), nil}},
+		{Name: "service.tags", Type: "list", Values: []any{[]any{"a", "b"}, nil}},
+		{Name: "type", Type: "string", Values: []any{"car", "door"}},
+		// the default is an int64 like the values of the entities, so the column isn't mixed
+		{Name: "points", Type: "int64", Values: []any{int64(5), int64(0)}},
+	}}
+	if got := enc.Batch(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Batch() = %+v, want %+v", got, want)
+	}
+
+	var written struct {
+		Rows    int `json:"rows"`
+		Columns []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &written); err != nil {
+		t.Fatalf("decoding %s: %v", b.String(), err)
+	}
+	if written.Rows != 2 || len(written.Columns) != 6 || written.Columns[2].Name != "service.amount" || written.Columns[2].Type != "int64" {
+		t.Errorf("written batch = %s", b.String())
+	}
+}
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		values []any
+		want   string
+	}{
+		{values: []any{}, want: "null"},
+		{values: []any{nil, nil}, want: "null"},
+		{values: []any{nil, int64(1), 2}, want: "int64"},
+		{values: []any{int64(1), 1.5}, want: "mixed"},
+		{values: []any{true, nil}, want: "bool"},
+	}
+
+	for _, tt := range tests {
+		if got := columnType(tt.values); got != tt.want {
+			t.Errorf("columnType(%v) = %s, want %s", tt.values, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -165,6 +166,22 @@ func (q *comparisonOperator) UnmarshalJSON(b []byte) error {
 		op = &inOperator{}
 	case "not_in":
 		op = &notInOperator{}
+	case "contains_all":
+		op = &containsAllOperator{}
+	case "not_contains_all":
+		op = &notContainsAllOperator{}
+	case "contains_any":
+		op = &containsAnyOperator{}
+	case "not_contains_any":
+		op = &notContainsAnyOperator{}
+	case "intersects":
+		op = &intersectsOperator{}
+	case "not_intersects":
+		op = &notIntersectsOperator{}
+	case "any":
+		op = &anyOperator{}
+	case "all":
+		op = &allOperator{}
 	}
 
 	if op != nil {
@@ -339,6 +356,170 @@ func (q *notInOperator) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// listOperands parses the list and the terms of list comparisons like {"list": "@order.tags", "terms": ["a", "b"]}
+func listOperands(b []byte, listKey, termsKey string) (list, terms listValueExpression, err error) {
+	var fields map[string]*json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return list, terms, err
+	}
+
+	for k, v := range map[string]*listValueExpression{listKey: &list, termsKey: &terms} {
+		rm, ok := fields[k]
+		if !ok {
+			return list, terms, fmt.Errorf("missing %s", k)
+		}
+		if err := json.Unmarshal(*rm, v); err != nil {
+			return list, terms, err
+		}
+	}
+
+	return list, terms, nil
+}
+
+type containsAllOperator struct {
+	operator.Comparison
+}
+
+func (q *containsAllOperator) UnmarshalJSON(b []byte) error {
+	list, terms, err := listOperands(b, "list", "terms")
+	if err != nil {
+		return err
+	}
+
+	q.Comparison = operator.NewContainsAll(list.value, terms.value)
+
+	return nil
+}
+
+type notContainsAllOperator struct {
+	operator.Comparison
+}
+
+func (q *notContainsAllOperator) UnmarshalJSON(b []byte) error {
+	var op containsAllOperator
+	if err := json.Unmarshal(b, &op); err != nil {
+		return err
+	}
+
+	q.Comparison = op.Comparison.Negate()
+	return nil
+}
+
+type containsAnyOperator struct {
+	operator.Comparison
+}
+
+func (q *containsAnyOperator) UnmarshalJSON(b []byte) error {
+	list, terms, err := listOperands(b, "list", "terms")
+	if err != nil {
+		return err
+	}
+
+	q.Comparison = operator.NewContainsAny(list.value, terms.value)
+
+	return nil
+}
+
+type notContainsAnyOperator struct {
+	operator.Comparison
+}
+
+func (q *notContainsAnyOperator) UnmarshalJSON(b []byte) error {
+	var op containsAnyOperator
+	if err := json.Unmarshal(b, &op); err != nil {
+		return err
+	}
+
+	q.Comparison = op.Comparison.Negate()
+	return nil
+}
+
+type intersectsOperator struct {
+	operator.Comparison
+}
+
+func (q *intersectsOperator) UnmarshalJSON(b []byte) error {
+	termA, termB, err := listOperands(b, "term_a", "term_b")
+	if err != nil {
+		return err
+	}
+
+	q.Comparison = operator.NewIntersects(termA.value, termB.value)
+
+	return nil
+}
+
+type notIntersectsOperator struct {
+	operator.Comparison
+}
+
+func (q *notIntersectsOperator) UnmarshalJSON(b []byte) error {
+	var op intersectsOperator
+	if err := json.Unmarshal(b, &op); err != nil {
+		return err
+	}
+
+	q.Comparison = op.Comparison.Negate()
+	return nil
+}
+
+// quantifierOperands parses quantifiers like {"list": "@order.driver_ratings", "where": {"less": ...}},
+// where the predicate refers to each element as @$
+func quantifierOperands(b []byte) (list listValueExpression, predicate comparisonOperator, err error) {
+	var fields map[string]*json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return list, predicate, err
+	}
+
+	rl, ok := fields["list"]
+	if !ok {
+		return list, predicate, errors.New("missing list")
+	}
+	if err := json.Unmarshal(*rl, &list); err != nil {
+		return list, predicate, err
+	}
+
+	rp, ok := fields["where"]
+	if !ok {
+		return list, predicate, errors.New("missing where")
+	}
+	if err := json.Unmarshal(*rp, &predicate); err != nil {
+		return list, predicate, err
+	}
+
+	return list, predicate, nil
+}
+
+type anyOperator struct {
+	operator.Comparison
+}
+
+func (q *anyOperator) UnmarshalJSON(b []byte) error {
+	list, predicate, err := quantifierOperands(b)
+	if err != nil {
+		return err
+	}
+
+	q.Comparison = operator.NewAny(list.value, predicate.operator)
+
+	return nil
+}
+
+type allOperator struct {
+	operator.Comparison
+}
+
+func (q *allOperator) UnmarshalJSON(b []byte) error {
+	list, predicate, err := quantifierOperands(b)
+	if err != nil {
+		return err
+	}
+
+	q.Comparison = operator.NewAll(list.value, predicate.operator)
+
+	return nil
+}
+
 type valueExpression struct {
 	value operator.Value
 }
@@ -374,6 +555,29 @@ func (q *valueExpression) UnmarshalJSON(b []byte) error {
 		return nil
 	}
 
+	var fields map[string]*json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	if rm, ok := fields["size"]; ok {
+		var list listValueExpression
+		if err := json.Unmarshal(*rm, &list); err != nil {
+			return err
+		}
+		q.value = operator.NewSize(list.value)
+		return nil
+	}
+
+	if rm, ok := fields["if"]; ok {
+		var conditionalOp conditionalOperator
+		if err := json.Unmarshal(*rm, &conditionalOp); err != nil {
+			return err
+		}
+		q.value = conditionalOp.operator
+		return nil
+	}
+
 	var arithmeticOp arithmeticOperator
 	if err := json.Unmarshal(b, &arithmeticOp); err != nil {
 		return err
@@ -430,6 +634,40 @@ func (q *sumOperator) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+type conditionalOperator struct {
+	operator operator.Value
+}
+
+func (q *conditionalOperator) UnmarshalJSON(b []byte) error {
+	var fields map[string]*json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	for _, k := range []string{"condition", "then", "else"} {
+		if _, ok := fields[k]; !ok {
+			return fmt.Errorf("conditional is missing %s", k)
+		}
+	}
+
+	var condition comparisonOperator
+	if err := json.Unmarshal(*fields["condition"], &condition); err != nil {
+		return err
+	}
+
+	var then, otherwise valueExpression
+	if err := json.Unmarshal(*fields["then"], &then); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(*fields["else"], &otherwise); err != nil {
+		return err
+	}
+
+	q.operator = operator.NewConditional(condition.operator, then.value, otherwise.value)
+
+	return nil
+}
+
 type listValueExpression struct {
 	value operator.ListValue
 }
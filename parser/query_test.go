@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/engine"
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+func TestQueryFromJSONListOperators(t *testing.T) {
+	entity := engine.NewEntity(1)
+	entity.AddField("ratings", value.NewList(value.NewInt64(3), value.NewInt64(5)))
+	entity.AddField("tags", value.NewList(value.NewString("a"), value.NewString("b")))
+	entity.AddField("other", value.NewList(value.NewString("c"), value.NewString("b")))
+	entity.AddField("min", value.NewInt64(4))
+
+	tests := []struct {
+		query string
+		want  logic.TruthValue
+	}{
+		{`{"any": {"list": "@ratings", "where": {"range": {"term": "@$", "from": 4}}}}`, logic.True},
+		{`{"all": {"list": "@ratings", "where": {"range": {"term": "@$", "from": 4}}}}`, logic.False},
+		{`{"any": {"list": "@ratings", "where": {"range": {"term": "@$", "from": "@min"}}}}`, logic.True},
+		{`{"not": {"any": {"list": "@ratings", "where": {"range": {"term": "@$", "from": 4}}}}}`, logic.False},
+		{`{"contains_all": {"list": "@tags", "terms": ["a", "b"]}}`, logic.True},
+		{`{"not_contains_all": {"list": "@tags", "terms": ["a", "z"]}}`, logic.True},
+		{`{"contains_any": {"list": "@tags", "terms": ["z", "a"]}}`, logic.True},
+		{`{"not_contains_any": {"list": "@tags", "terms": ["z"]}}`, logic.True},
+		{`{"intersects": {"term_a": "@tags", "term_b": "@other"}}`, logic.True},
+		{`{"not_intersects": {"term_a": "@tags", "term_b": "@other"}}`, logic.False},
+		{`{"equal": {"term_a": {"size": "@tags"}, "term_b": 2}}`, logic.True},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := QueryFromJSON([]byte(`{"and": [` + tt.query + `]}`))
+			if err != nil {
+				t.Fatalf("QueryFromJSON() error = %v", err)
+			}
+
+			tv, err := query.Resolve(&entity)
+			if err != nil || tv != tt.want {
+				t.Errorf("Resolve() = %v, %v, want %v", tv, err, tt.want)
+			}
+		})
+	}
+}
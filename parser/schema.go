@@ -1,54 +1,425 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/ZarthaxX/query-resolver/engine"
 	"github.com/ZarthaxX/query-resolver/logic"
 	"github.com/ZarthaxX/query-resolver/operator"
 	"github.com/ZarthaxX/query-resolver/value"
 
-	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
+/*
+Template maps the fields of entities to JSON objects, keeping the order of its keys.
+A "$null": true entry renders every missing field of the template and its children as null,
+unless the field says otherwise, and an entry like "id": "$id" renders the ID of engine entities,
+or of any other entity with a GetID method returning any.
+*/
 type Template struct {
-	fields map[string]value.FieldName
+	keys   []string
+	fields map[string]templateField
 	childs map[string]Template
 }
 
+/*
+templateField is an entry of the template rendering a field.
+It is written either as the field name, or as an object like {"$field": "order.status", "$meta": "source"}
+where $meta renders some of the metadata the engine keeps about the field instead of its value.
+The object can also set a $default value rendered when the entity doesn't have the field,
+$null to render it as null instead, and a $time_layout to render unix seconds and times as formatted strings.
+Instead of $field, it can set an $expr computed from the fields of the entity, written like the values of a query, such as
+{"$expr": {"sum": {"term_a": "@service.start", "term_b": 600}}} or {"$expr": {"size": "@order.tags"}}.
+*/
+type templateField struct {
+	id         bool
+	name       value.FieldName
+	meta       string
+	expression operator.Value
+	defaultV   any
+	hasDefault bool
+	null       *bool
+	timeLayout string
+}
+
+var templateFieldMetas = []string{"source", "fetched_at", "round", "omitted"}
+
+type metadataEntity interface {
+	GetFieldMetadata(f value.FieldName) (engine.FieldMetadata, bool)
+}
+
+type identifiedEntity interface {
+	GetID() any
+}
+
+type anyIDEntity interface {
+	GetAnyID() any
+}
+
 func (s *Template) UnmarshalJSON(b []byte) error {
-	s.fields = map[string]value.FieldName{}
+	s.fields = map[string]templateField{}
 	s.childs = map[string]Template{}
 
 	names := map[string]*json.RawMessage{}
 	if err := json.Unmarshal(b, &names); err != nil {
 		return err
 	}
-	for k, v := range names {
+
+	keys, err := objectKeys(b)
+	if err != nil {
+		return err
+	}
+
+	if rm, ok := names["$null"]; ok {
+		var null bool
+		if err := json.Unmarshal(*rm, &null); err != nil {
+			return err
+		}
+		delete(names, "$null")
+		// children were not parsed yet, so the mode is applied once they are
+		defer s.setNullMode(null)
+	}
+
+	for _, k := range keys {
+		v, ok := names[k]
+		if !ok {
+			continue
+		}
+		s.keys = append(s.keys, k)
+
+		var fieldName string
+		if err := json.Unmarshal(*v, &fieldName); err == nil {
+			s.fields[k] = templateField{name: value.FieldName(fieldName), id: fieldName == "$id"}
+			continue
+		}
+
+		var spec map[string]*json.RawMessage
+		if err := json.Unmarshal(*v, &spec); err != nil {
+			return err
+		}
+
+		_, isField := spec["$field"]
+		_, isExpression := spec["$expr"]
+		if isField || isExpression {
+			var field templateField
+			if err := field.unmarshalSpec(spec); err != nil {
+				return fmt.Errorf("template field %s: %w", k, err)
+			}
+			s.fields[k] = field
+			continue
+		}
+
 		var schema Template
 		if err := json.Unmarshal(*v, &schema); err != nil {
-			var fieldName string
-			if err := json.Unmarshal(*v, &fieldName); err != nil {
-				return err
-			}
-			s.fields[k] = value.FieldName(fieldName)
-		} else {
-			s.childs[k] = schema
+			return err
 		}
+		s.childs[k] = schema
 	}
 	return nil
 }
 
-func (s *Template) GetResultSchema() []value.FieldName {
-	return s.getFieldNames()
+// objectKeys returns the keys of the JSON object in the order they are written, without repeating them
+func objectKeys(b []byte) ([]string, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		if k := t.(string); !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
 }
 
-func (s *Template) getFieldNames() []value.FieldName {
-	fieldNames := maps.Values(s.fields)
+func (f *templateField) unmarshalSpec(spec map[string]*json.RawMessage) error {
+	if rm, ok := spec["$expr"]; ok {
+		if _, ok := spec["$field"]; ok {
+			return errors.New("a field can't have both $field and $expr")
+		}
+		if _, ok := spec["$meta"]; ok {
+			return errors.New("an expression has no metadata")
+		}
+
+		var expression valueExpression
+		if err := json.Unmarshal(*rm, &expression); err != nil {
+			return err
+		}
+		f.expression = expression.value
+	} else if err := json.Unmarshal(*spec["$field"], &f.name); err != nil {
+		return err
+	}
+
+	if rm, ok := spec["$meta"]; ok {
+		if err := json.Unmarshal(*rm, &f.meta); err != nil {
+			return err
+		}
+		if !slices.Contains(templateFieldMetas, f.meta) {
+			return fmt.Errorf("unknown field metadata %s", f.meta)
+		}
+	}
+
+	if rm, ok := spec["$default"]; ok {
+		defaultV, err := decodeDefault(*rm)
+		if err != nil {
+			return err
+		}
+		f.defaultV, f.hasDefault = defaultV, true
+	}
+
+	if rm, ok := spec["$null"]; ok {
+		f.null = new(bool)
+		if err := json.Unmarshal(*rm, f.null); err != nil {
+			return err
+		}
+	}
+
+	if rm, ok := spec["$time_layout"]; ok {
+		if err := json.Unmarshal(*rm, &f.timeLayout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeDefault keeps integral numbers as int64, like the values of the entities, instead of float64
+func decodeDefault(raw json.RawMessage) (any, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return defaultNumbers(v), nil
+}
+
+func defaultNumbers(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		n, _ := t.Float64()
+		return n
+	case []any:
+		for i, lv := range t {
+			t[i] = defaultNumbers(lv)
+		}
+	case map[string]any:
+		for k, mv := range t {
+			t[k] = defaultNumbers(mv)
+		}
+	}
+
+	return v
+}
+
+// setNullMode renders missing fields as null, except for the ones that already chose how to render them
+func (s *Template) setNullMode(null bool) {
+	for k, f := range s.fields {
+		if f.null == nil {
+			f.null = &null
+			s.fields[k] = f
+		}
+	}
+
 	for _, c := range s.childs {
-		fieldNames = append(fieldNames, c.getFieldNames()...)
+		c.setNullMode(null)
+	}
+}
+
+// isOptional tells if the field is rendered even for entities that don't have it
+func (f *templateField) isOptional() bool {
+	return f.hasDefault || (f.null != nil && *f.null)
+}
+
+// render returns the value of the field for the entity, and if it should be rendered at all.
+// Fields the entity doesn't have are rendered with their default, or as null if the field says so.
+func (f *templateField) render(entity operator.Entity) (any, bool, error) {
+	v, ok, err := f.renderValue(entity)
+	if err != nil || ok {
+		return v, ok, err
+	}
+
+	if f.hasDefault {
+		return f.defaultV, true, nil
+	}
+	if f.null != nil && *f.null {
+		return nil, true, nil
+	}
+
+	return nil, false, nil
+}
+
+func (f *templateField) renderValue(entity operator.Entity) (any, bool, error) {
+	if f.id {
+		return entityID(entity)
+	}
+
+	if f.expression != nil {
+		if !f.expression.IsResolvable(entity) {
+			return nil, false, nil
+		}
+
+		cv, err := f.expression.Resolve(entity)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return f.format(cv)
 	}
 
-	return fieldNames
+	if f.meta == "" {
+		if entity.FieldExists(f.name) != logic.True {
+			return nil, false, nil
+		}
+
+		cv, _ := entity.SeekField(f.name)
+		return f.format(cv)
+	}
+
+	me, ok := entity.(metadataEntity)
+	if !ok {
+		return nil, false, nil
+	}
+
+	metadata, ok := me.GetFieldMetadata(f.name)
+	if !ok {
+		return nil, false, nil
+	}
+
+	switch f.meta {
+	case "source":
+		return metadata.Source, true, nil
+	case "fetched_at":
+		if f.timeLayout != "" {
+			return metadata.FetchedAt.Format(f.timeLayout), true, nil
+		}
+		return metadata.FetchedAt, true, nil
+	case "round":
+		return metadata.Round, true, nil
+	default:
+		return metadata.Omitted, true, nil
+	}
+}
+
+// entityID returns the ID of entities that have one, like engine.Entity whatever the type of its ID is
+func entityID(entity operator.Entity) (any, bool, error) {
+	switch e := entity.(type) {
+	case identifiedEntity:
+		return e.GetID(), true, nil
+	case anyIDEntity:
+		return e.GetAnyID(), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// format renders the value as a JSON primitive, or as an array of them for lists
+func (f *templateField) format(cv value.Value) (any, bool, error) {
+	v, ok := cv.Value()
+	if !ok {
+		return nil, false, nil
+	}
+
+	if list, ok := cv.(value.List); ok {
+		values := []any{}
+		for _, lv := range list.Values() {
+			rv, ok, err := f.format(lv)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				values = append(values, rv)
+			}
+		}
+		return values, true, nil
+	}
+
+	if f.timeLayout == "" {
+		return v, true, nil
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0).UTC().Format(f.timeLayout), true, nil
+	case float64:
+		return time.UnixMilli(int64(t * 1000)).UTC().Format(f.timeLayout), true, nil
+	case time.Time:
+		return t.Format(f.timeLayout), true, nil
+	default:
+		return nil, false, fmt.Errorf("field %s of type %T can't be formatted as a time", f.name, v)
+	}
+}
+
+func (s *Template) GetResultSchema() []value.FieldName {
+	required, optional := s.getFieldNames()
+	return append(required, optional...)
+}
+
+/*
+GetOptionalFields returns the fields of the result schema the template can render without,
+because it has a default or null for them, or only uses them in expressions.
+They are meant to be marked as optional with engine.WithOptionalFields, so entities lacking them are kept.
+*/
+func (s *Template) GetOptionalFields() []value.FieldName {
+	required, optional := s.getFieldNames()
+	return slices.DeleteFunc(optional, func(f value.FieldName) bool {
+		// a field required anywhere in the template is not optional
+		return slices.Contains(required, f)
+	})
+}
+
+// getFieldNames returns the fields the template needs, and apart the ones it can render without
+func (s *Template) getFieldNames() ([]value.FieldName, []value.FieldName) {
+	required, optional := []value.FieldName{}, []value.FieldName{}
+	for _, k := range s.keys {
+		f, ok := s.fields[k]
+		if !ok || f.id {
+			continue
+		}
+
+		if f.expression == nil && f.isOptional() {
+			optional = append(optional, f.name)
+			continue
+		}
+		if f.expression == nil {
+			required = append(required, f.name)
+			continue
+		}
+
+		// an expression may not need every field it references, so entities without them are kept
+		optional = append(optional, f.expression.GetFieldNames()...)
+	}
+	for _, k := range s.keys {
+		if c, ok := s.childs[k]; ok {
+			childRequired, childOptional := c.getFieldNames()
+			required = append(required, childRequired...)
+			optional = append(optional, childOptional...)
+		}
+	}
+
+	return required, optional
 }
 
 func TemplateFromJSON(data []byte) (Template, error) {
@@ -56,27 +427,70 @@ func TemplateFromJSON(data []byte) (Template, error) {
 	return template, json.Unmarshal(data, &template)
 }
 
-func (t *Template) entityToMap(entity operator.Entity) (res map[string]any, err error) {
-	res = map[string]any{}
-	for f, fn := range t.fields {
-		if entity.FieldExists(fn) == logic.True {
-			cv, _ := entity.SeekField(fn)
-			res[f], _ = cv.Value()
+// object is a JSON object that keeps the order of its keys
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) set(k string, v any) {
+	o.keys = append(o.keys, k)
+	o.values[k] = v
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
 		}
+
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(kb)
+		b.WriteByte(':')
+		b.Write(vb)
 	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+func (t *Template) entityToMap(entity operator.Entity) (*object, error) {
+	res := &object{values: map[string]any{}}
+	for _, k := range t.keys {
+		if f, ok := t.fields[k]; ok {
+			v, ok, err := f.render(entity)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res.set(k, v)
+			}
+			continue
+		}
 
-	for n, c := range t.childs {
-		res[n], err = c.entityToMap(entity)
+		c := t.childs[k]
+		child, err := c.entityToMap(entity)
 		if err != nil {
 			return nil, err
 		}
+		res.set(k, child)
 	}
 
 	return res, nil
 }
 
 func (t *Template) EntitiesToJSON(entities ...operator.Entity) ([]byte, error) {
-	entitiesMap := []map[string]any{}
+	entitiesMap := []*object{}
 	for _, e := range entities {
 		entityMap, err := t.entityToMap(e)
 		if err != nil {
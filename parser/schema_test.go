@@ -0,0 +1,353 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/engine"
+	"github.com/ZarthaxX/query-resolver/logic"
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+	"golang.org/x/exp/slices"
+)
+
+func TestTemplateNestedObjectsAreNotExpressions(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"totals": {"sum": "order.sum"},
+		"box": {"size": "box.size"},
+		"branch": {"if": "order.branch"}
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	entity := engine.NewEntity("1")
+	entity.AddField("order.sum", value.NewInt64(10))
+	entity.AddField("box.size", value.NewString("large"))
+	entity.AddField("order.branch", value.NewString("main"))
+
+	got, err := template.EntityToJSON(&entity)
+	if err != nil {
+		t.Fatalf("EntityToJSON() error = %v", err)
+	}
+	want := `{"totals":{"sum":10},"box":{"size":"large"},"branch":{"if":"main"}}`
+	if compact(got) != want {
+		t.Errorf("EntityToJSON() = %s, want %s", compact(got), want)
+	}
+}
+
+func TestTemplateExpressions(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"eta": {"$expr": {"sum": {"term_a": "@service.start", "term_b": 600}}},
+		"tags": {"$expr": {"size": "@order.tags"}, "$default": 0}
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	entity := engine.NewEntity("1")
+	entity.AddField("service.start", value.NewInt64(1000))
+
+	got, err := template.EntityToJSON(&entity)
+	if err != nil {
+		t.Fatalf("EntityToJSON() error = %v", err)
+	}
+	if want := `{"eta":1600,"tags":0}`; compact(got) != want {
+		t.Errorf("EntityToJSON() = %s, want %s", compact(got), want)
+	}
+}
+
+func TestTemplateRejectsInvalidExpressions(t *testing.T) {
+	for _, data := range []string{
+		`{"eta": {"$expr": {"sum": {"term_a": "@a", "term_b": 1}}, "$field": "a"}}`,
+		`{"eta": {"$expr": {"sum": {"term_a": "@a", "term_b": 1}}, "$meta": "source"}}`,
+	} {
+		if _, err := TemplateFromJSON([]byte(data)); err == nil {
+			t.Errorf("TemplateFromJSON(%s) accepted an invalid expression", data)
+		}
+	}
+}
+
+func TestTemplateResultSchema(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"id": "$id",
+		"status": "order.status",
+		"type": {"$field": "order.type", "$default": "door"},
+		"driver": {"$field": "order.driver", "$null": true},
+		"eta": {"$expr": {"sum": {"term_a": "@service.start", "term_b": 600}}},
+		"service": {"amount": "service.amount", "start": "service.start"}
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	want := []value.FieldName{"order.status", "service.amount", "service.start", "order.type", "order.driver", "service.start"}
+	if got := template.GetResultSchema(); !slices.Equal(got, want) {
+		t.Errorf("GetResultSchema() = %v, want %v", got, want)
+	}
+	// service.start is rendered as is too, so it is required
+	if got, want := template.GetOptionalFields(), []value.FieldName{"order.type", "order.driver"}; !slices.Equal(got, want) {
+		t.Errorf("GetOptionalFields() = %v, want %v", got, want)
+	}
+}
+
+func TestTemplateDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaultV string
+		want     any
+	}{
+		{name: "integer", defaultV: `3`, want: int64(3)},
+		{name: "float", defaultV: `1.5`, want: 1.5},
+		{name: "string", defaultV: `"door"`, want: "door"},
+		{name: "list", defaultV: `[1, 2.5]`, want: []any{int64(1), 2.5}},
+		{name: "object", defaultV: `{"n": 1}`, want: map[string]any{"n": int64(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := TemplateFromJSON([]byte(`{"n": {"$field": "n", "$default": ` + tt.defaultV + `}}`))
+			if err != nil {
+				t.Fatalf("TemplateFromJSON() error = %v", err)
+			}
+
+			entity, f := engine.NewEntity("1"), template.fields["n"]
+			got, ok, err := f.render(&entity)
+			if err != nil || !ok {
+				t.Fatalf("render() = %v, %v", ok, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("render() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateMissingFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "left out", template: `{"status": "order.status", "type": "order.type"}`, want: `{"status":"done"}`},
+		{name: "default", template: `{"type": {"$field": "order.type", "$default": "door"}}`, want: `{"type":"door"}`},
+		{name: "null", template: `{"type": {"$field": "order.type", "$null": true}}`, want: `{"type":null}`},
+		{
+			name:     "null mode",
+			template: `{"$null": true, "type": "order.type", "service": {"amount": "service.amount"}}`,
+			want:     `{"type":null,"service":{"amount":null}}`,
+		},
+		{
+			name:     "null mode with exceptions",
+			template: `{"$null": true, "type": {"$field": "order.type", "$null": false}, "amount": "service.amount"}`,
+			want:     `{"amount":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := TemplateFromJSON([]byte(tt.template))
+			if err != nil {
+				t.Fatalf("TemplateFromJSON() error = %v", err)
+			}
+
+			entity := engine.NewEntity("1")
+			entity.AddField("order.status", value.NewString("done"))
+
+			got, err := template.EntityToJSON(&entity)
+			if err != nil {
+				t.Fatalf("EntityToJSON() error = %v", err)
+			}
+			if compact(got) != tt.want {
+				t.Errorf("EntityToJSON() = %s, want %s", compact(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateTimeLayout(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"start": {"$field": "service.start", "$time_layout": "2006-01-02T15:04:05Z07:00"},
+		"tags": "order.tags"
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	entity := engine.NewEntity("1")
+	entity.AddField("service.start", value.NewInt64(86400))
+	entity.AddField("order.tags", value.NewList(value.NewString("a"), value.NewString("b")))
+
+	got, err := template.EntityToJSON(&entity)
+	if err != nil {
+		t.Fatalf("EntityToJSON() error = %v", err)
+	}
+	if want := `{"start":"1970-01-02T00:00:00Z","tags":["a","b"]}`; compact(got) != want {
+		t.Errorf("EntityToJSON() = %s, want %s", compact(got), want)
+	}
+
+	// decoding undoes the layout
+	decoded, err := EntityFromJSON[string](&template, got)
+	if err != nil {
+		t.Fatalf("EntityFromJSON() error = %v", err)
+	}
+	if start, _ := decoded.SeekField("service.start"); !reflect.DeepEqual(start, value.NewInt64(86400)) {
+		t.Errorf("decoded service.start = %v, want 86400", start)
+	}
+
+	entity.AddField("service.start", value.NewString("soon"))
+	if _, err := template.EntityToJSON(&entity); err == nil {
+		t.Error("EntityToJSON() formatted a string as a time")
+	}
+}
+
+// customIDEntity chooses how its ID is rendered
+type customIDEntity struct {
+	engine.Entity[string]
+}
+
+func (e customIDEntity) GetID() any {
+	return struct{ Code string }{Code: e.Entity.GetID()}
+}
+
+// anonymousEntity has no ID at all
+type anonymousEntity struct {
+	entity engine.Entity[string]
+}
+
+func (e *anonymousEntity) SeekField(f value.FieldName) (value.Value, error) {
+	return e.entity.SeekField(f)
+}
+
+func (e *anonymousEntity) FieldExists(f value.FieldName) logic.TruthValue {
+	return e.entity.FieldExists(f)
+}
+
+func (e *anonymousEntity) AddField(name value.FieldName, v value.Value) {
+	e.entity.AddField(name, v)
+}
+
+func TestTemplateEntityID(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{"id": "$id", "status": "order.status"}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	withStatus := func(entity engine.Entity[string]) engine.Entity[string] {
+		entity.AddField("order.status", value.NewString("done"))
+		return entity
+	}
+	intEntity := engine.NewEntity(7)
+	intEntity.AddField("order.status", value.NewString("done"))
+	type orderID string
+	namedEntity := engine.NewEntity(orderID("o"))
+	namedEntity.AddField("order.status", value.NewString("done"))
+
+	tests := []struct {
+		name   string
+		entity operator.Entity
+		want   string
+	}{
+		{name: "string", entity: ptr(withStatus(engine.NewEntity("a"))), want: `{"id":"a","status":"done"}`},
+		{name: "int", entity: &intEntity, want: `{"id":7,"status":"done"}`},
+		{name: "named type", entity: &namedEntity, want: `{"id":"o","status":"done"}`},
+		{name: "any", entity: &customIDEntity{withStatus(engine.NewEntity("a"))}, want: `{"id":{"Code":"a"},"status":"done"}`},
+		{name: "without id", entity: &anonymousEntity{withStatus(engine.NewEntity("a"))}, want: `{"status":"done"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := template.EntityToJSON(tt.entity)
+			if err != nil {
+				t.Fatalf("EntityToJSON() error = %v", err)
+			}
+			if compact(got) != tt.want {
+				t.Errorf("EntityToJSON() = %s, want %s", compact(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateKeepsKeyOrder(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"status": "order.status",
+		"id": "$id",
+		"service": {"start": "service.start", "amount": "service.amount"},
+		"amount": "order.amount"
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	entity := engine.NewEntity("1")
+	entity.AddField("order.status", value.NewString("done"))
+	entity.AddField("service.start", value.NewInt64(1000))
+	entity.AddField("service.amount", value.NewInt64(20))
+	entity.AddField("order.amount", value.NewInt64(30))
+
+	got, err := template.EntitiesToJSON(&entity, &entity)
+	if err != nil {
+		t.Fatalf("EntitiesToJSON() error = %v", err)
+	}
+	object := `{"status":"done","id":"1","service":{"start":1000,"amount":20},"amount":30}`
+	if want := "[" + object + "," + object + "]"; compact(got) != want {
+		t.Errorf("EntitiesToJSON() = %s, want %s", compact(got), want)
+	}
+}
+
+func TestEntityFromJSON(t *testing.T) {
+	template, err := TemplateFromJSON([]byte(`{
+		"id": "$id",
+		"status": "order.status",
+		"driver": {"$field": "order.driver", "$null": true},
+		"source": {"$field": "order.status", "$meta": "source"},
+		"service": {"amount": "service.amount", "tags": "service.tags"}
+	}`))
+	if err != nil {
+		t.Fatalf("TemplateFromJSON() error = %v", err)
+	}
+
+	entity, err := EntityFromJSON[int](&template, []byte(`{
+		"id": 3,
+		"status": "done",
+		"driver": null,
+		"source": "orders",
+		"service": {"amount": 1.5, "tags": ["a", 2]}
+	}`))
+	if err != nil {
+		t.Fatalf("EntityFromJSON() error = %v", err)
+	}
+
+	if entity.GetID() != 3 {
+		t.Errorf("GetID() = %v, want 3", entity.GetID())
+	}
+	want := map[value.FieldName]value.Value{
+		"order.status":   value.NewString("done"),
+		"order.driver":   value.Undefined{},
+		"service.amount": value.NewFloat64(1.5),
+		"service.tags":   value.NewList(value.NewString("a"), value.NewInt64(2)),
+	}
+	for f, v := range want {
+		if got, _ := entity.SeekField(f); !reflect.DeepEqual(got, v) {
+			t.Errorf("field %s = %v, want %v", f, got, v)
+		}
+	}
+
+	if _, err := EntityFromJSON[int](&template, []byte(`{"id": "three"}`)); err == nil {
+		t.Error("EntityFromJSON() decoded a string ID as an int")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func compact(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return string(b)
+	}
+	return buf.String()
+}
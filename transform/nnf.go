@@ -5,7 +5,8 @@ import "github.com/ZarthaxX/query-resolver/operator"
 func ToNegationNormalForm(query operator.Comparison) operator.Comparison {
 	switch qt := query.(type) {
 	case *operator.Not:
-		return qt.Negate()
+		// the negation is pushed into the term, which may be compound
+		return ToNegationNormalForm(qt.Term.Negate())
 	case *operator.And:
 		and := query.(*operator.And)
 		terms := []operator.Comparison{}
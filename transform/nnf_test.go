@@ -0,0 +1,37 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/operator"
+	"github.com/ZarthaxX/query-resolver/value"
+)
+
+func TestToNegationNormalForm(t *testing.T) {
+	a := operator.NewEqual(operator.NewField("a"), operator.NewConst(value.NewInt64(1)))
+	b := operator.NewExists("b")
+
+	tests := []struct {
+		name  string
+		query operator.Comparison
+		want  operator.Comparison
+	}{
+		{"negated term", operator.NewNot(a), a.Negate()},
+		{"double negation", operator.NewNot(operator.NewNot(a)), a},
+		{"negated and", operator.NewNot(operator.NewAnd(a, b)), operator.NewOr(a.Negate(), b.Negate())},
+		{"negated or", operator.NewNot(operator.NewOr(a, b)), operator.NewAnd(a.Negate(), b.Negate())},
+		{
+			"nested negation",
+			operator.NewAnd(operator.NewNot(operator.NewOr(a, operator.NewNot(b)))),
+			operator.NewAnd(operator.NewAnd(a.Negate(), b)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToNegationNormalForm(tt.query); got.String() != tt.want.String() {
+				t.Errorf("ToNegationNormalForm(%s) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
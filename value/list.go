@@ -0,0 +1,131 @@
+package value
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+)
+
+/*
+List is a value holding a list of values.
+Two lists are equal when they have the same length and their elements are equal in order,
+which is Undefined if some pair of elements can't tell.
+*/
+type List struct {
+	values []Value
+}
+
+func NewList(values ...Value) List {
+	if values == nil {
+		values = []Value{}
+	}
+
+	return List{values: values}
+}
+
+// Values returns the elements of the list
+func (v List) Values() []Value {
+	return v.values
+}
+
+func (v List) Len() int {
+	return len(v.values)
+}
+
+/*
+Contains returns if some element of the list is equal to the value.
+It is Undefined when no element is, but some of them couldn't tell, like when the value or an element is Undefined.
+*/
+func (v List) Contains(o Value) (logic.TruthValue, error) {
+	res := logic.False
+	for _, lv := range v.values {
+		tv, err := lv.Equal(o)
+		if err != nil {
+			return logic.Undefined, err
+		}
+
+		res = res.Or(tv)
+		if res == logic.True {
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+/*
+ElementType returns the type of the elements of the list, like "int64", "string" or "list" for lists of lists.
+It is empty when the list has no defined elements, and "mixed" when they have different types.
+*/
+func (v List) ElementType() string {
+	t := ""
+	for _, lv := range v.values {
+		raw, ok := lv.Value()
+		if !ok {
+			continue
+		}
+
+		lt := fmt.Sprintf("%T", raw)
+		if _, ok := lv.(List); ok {
+			lt = "list"
+		}
+
+		if t != "" && t != lt {
+			return "mixed"
+		}
+		t = lt
+	}
+
+	return t
+}
+
+func (v List) MustValue() any {
+	return v.values
+}
+
+func (v List) Value() (any, bool) {
+	return v.values, true
+}
+
+func (v List) Equal(o Value) (logic.TruthValue, error) {
+	if _, ok := o.Value(); !ok {
+		return logic.Undefined, nil
+	}
+
+	ol, ok := o.(List)
+	if !ok {
+		return logic.False, errors.New("invalid type")
+	}
+
+	if len(v.values) != len(ol.values) {
+		return logic.False, nil
+	}
+
+	res := logic.True
+	for i := range v.values {
+		tv, err := v.values[i].Equal(ol.values[i])
+		if err != nil {
+			return logic.False, err
+		}
+
+		res = res.And(tv)
+		if res == logic.False {
+			return res, nil
+		}
+	}
+
+	return res, nil
+}
+
+func (v List) Less(o Value) (logic.TruthValue, error) {
+	return logic.Undefined, errors.New("incomparable value")
+}
+
+func (v List) Plus(o Value) (Value, error) {
+	return Undefined{}, errors.New("incomparable value")
+}
+
+func (v List) Minus(o Value) (Value, error) {
+	return Undefined{}, errors.New("incomparable value")
+}
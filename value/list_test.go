@@ -0,0 +1,67 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/ZarthaxX/query-resolver/logic"
+)
+
+func TestListContains(t *testing.T) {
+	list := NewList(NewString("a"), NewString("b"))
+	withUndefined := NewList(NewString("a"), Undefined{}, NewString("b"))
+
+	tests := []struct {
+		name string
+		list List
+		v    Value
+		want logic.TruthValue
+	}{
+		{"contained", list, NewString("b"), logic.True},
+		{"not contained", list, NewString("z"), logic.False},
+		{"contained next to undefined", withUndefined, NewString("b"), logic.True},
+		// the undefined element may be the value
+		{"not contained next to undefined", withUndefined, NewString("z"), logic.Undefined},
+		{"empty", NewList(), NewString("a"), logic.False},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv, err := tt.list.Contains(tt.v)
+			if err != nil || tv != tt.want {
+				t.Errorf("Contains() = %v, %v, want %v", tv, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b List
+		want logic.TruthValue
+	}{
+		{"equal", NewList(NewInt64(1), NewInt64(2)), NewList(NewInt64(1), NewInt64(2)), logic.True},
+		{"different order", NewList(NewInt64(1), NewInt64(2)), NewList(NewInt64(2), NewInt64(1)), logic.False},
+		{"different length", NewList(NewInt64(1)), NewList(NewInt64(1), NewInt64(2)), logic.False},
+		{"undefined element", NewList(NewInt64(1), Undefined{}), NewList(NewInt64(1), NewInt64(2)), logic.Undefined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv, err := tt.a.Equal(tt.b)
+			if err != nil || tv != tt.want {
+				t.Errorf("Equal() = %v, %v, want %v", tv, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListIsNotOrdered(t *testing.T) {
+	list := NewList(NewInt64(1))
+	if _, err := list.Less(list); err == nil {
+		t.Error("Less() compared two lists")
+	}
+	if _, err := list.Plus(list); err == nil {
+		t.Error("Plus() added two lists")
+	}
+}